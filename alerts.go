@@ -31,6 +31,7 @@ type alertType string
 const (
 	alertRaised    = "alert-raised"
 	alertRecovered = "alert-recovered"
+	alertNotice    = "alert-notice" // internal, e.g. overflow
 )
 
 // note: rolls over at bounds (minimally ~91 days given a 1m alert period)
@@ -74,6 +75,45 @@ func newAlert(reqcnt uint, ts time.Time) (*alert, error) {
 	return &alert{id, alertRaised, ts, msg}, nil
 }
 
+// routes with fewer requests in the SLO window are not alerted on
+const sloAlertMinRequests = 100
+
+// creates a new alert-raised (notice) of a route's SLO breach (c.f.
+// sloStatus.breach). Returns error on zero-value ts.
+func newSloAlert(route, breach string, ts time.Time) (*alert, error) {
+	if ts.IsZero() {
+		return nil, fmt.Errorf("bug - newSloAlert - assert - timestamp is zero-value")
+	}
+	id := nextAlertId()
+	fmtstr := "SLO alert {%d} - route {%s} - %s, triggered at {%s}"
+	msg := fmt.Sprintf(fmtstr, id, route, breach, ts.Format(time.RFC3339))
+	return &alert{id, alertRaised, ts, msg}, nil
+}
+
+// creates a new alert-raised (notice) of a measure deviating from its
+// seasonal baseline (c.f. anomaly). Returns error on zero-value ts.
+func newAnomalyAlert(a anomaly, ts time.Time) (*alert, error) {
+	if ts.IsZero() {
+		return nil, fmt.Errorf("bug - newAnomalyAlert - assert - timestamp is zero-value")
+	}
+	id := nextAlertId()
+	fmtstr := "Anomaly alert {%d} - {%s} = %.3g vs baseline %.3g (z = %+.1f), triggered at {%s}"
+	msg := fmt.Sprintf(fmtstr, id, a.name, a.current, a.mean, a.z(), ts.Format(time.RFC3339))
+	return &alert{id, alertRaised, ts, msg}, nil
+}
+
+// creates an internal notice of a dimension that exceeded the key cap
+// (c.f. cappedTable). Returns error on zero-value ts.
+func newOverflowNotice(dimension string, cap uint, folded uint64, ts time.Time) (*alert, error) {
+	if ts.IsZero() {
+		return nil, fmt.Errorf("bug - newOverflowNotice - assert - timestamp is zero-value")
+	}
+	id := nextAlertId()
+	fmtstr := "Notice {%d} - dimension {%s} exceeded %d keys, ~%d folded into %s, at {%s}"
+	msg := fmt.Sprintf(fmtstr, id, dimension, cap, folded, otherKey, ts.Format(time.RFC3339))
+	return &alert{id, alertNotice, ts, msg}, nil
+}
+
 // creates the alert-recovered (notice) complement for the reciever.
 // Returns error if receiver is not of type 'alertRaised', or if
 // input arg is zero-value.
@@ -0,0 +1,155 @@
+//    Copyright © 2016 Joubin Houshyar. All rights reserved.
+//
+//    This file is part of puppy.
+//
+//    puppy is free software: you can redistribute it and/or modify
+//    it under the terms of the GNU Affero General Public License as
+//    published by the Free Software Foundation, either version 3 of
+//    the License, or (at your option) any later version.
+//
+//    puppy is distributed in the hope that it will be useful,
+//    but WITHOUT ANY WARRANTY; without even the implied warranty of
+//    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//    GNU Affero General Public License for more details.
+//
+//    You should have received a copy of the GNU Affero General Public
+//    License along with puppy.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"math"
+	"time"
+)
+
+// General note:
+// A fixed traffic threshold (c.f. conf.trafficLimitHigh) is blind to
+// daily and weekly seasonality. The baseline of a time is learned from
+// the hourly rollups of the same hour of the week in prior weeks, or
+// until there are enough weeks, of the same hour of the day in prior
+// days. The last whole minute is scored against the (per minute) mean of
+// the baseline as a z-score, i.e. (x - mean) / stddev, for traffic, error
+// rate, and the top routes.
+//
+// Rollups only keep the counts of the top routes of each snapshot (c.f.
+// baselineTopRoutes) so route counts are low for routes that are not
+// always on top, but are so for the baseline and the last minute alike.
+//
+// As rollups are in memory, the baseline is learned anew on startup and
+// is only available after a few days. Hours that puppy was not running
+// (in full) bias the baseline low.
+
+// minimum samples of a baseline
+const baselineMinSamples = 3
+
+// routes of a snapshot kept by rollups, and the top routes scored
+const (
+	baselineTopRoutes = 10
+	baselineRoutes    = 5
+)
+
+// the names of the non-route anomalies
+const (
+	anomalyTraffic = "traffic"
+	anomalyErrors  = "errors"
+)
+
+// the deviation of a measure of the last minute from its baseline
+type anomaly struct {
+	name         string // anomalyTraffic, anomalyErrors, or a route
+	current      float64
+	mean, stddev float64 // stddev is floored, c.f. score
+	samples      int
+	weekly       bool // per hour of week, else hour of day
+}
+
+func (p anomaly) z() float64 { return (p.current - p.mean) / p.stddev }
+
+// returns the completed hourly buckets of the same hour of week as ts,
+// or if there are too few, of the same hour of day.
+func (p *rollups) seasonal(ts time.Time) (samples []*rollupBucket, weekly bool) {
+	var hourly *rollupTier
+	for _, tier := range p.tiers {
+		if tier.resolution == time.Hour {
+			hourly = tier
+		}
+	}
+	if hourly == nil {
+		return nil, false
+	}
+	byStart := make(map[int64]*rollupBucket)
+	for _, obj := range hourly.buckets.items() {
+		bucket := obj.(*rollupBucket)
+		byStart[bucket.start.Unix()] = bucket
+	}
+	hour := ts.Truncate(time.Hour)
+	collect := func(period time.Duration) []*rollupBucket {
+		var buckets []*rollupBucket
+		for k := 1; k <= len(byStart); k++ {
+			if bucket, ok := byStart[hour.Add(-time.Duration(k)*period).Unix()]; ok {
+				buckets = append(buckets, bucket)
+			}
+		}
+		return buckets
+	}
+	if samples = collect(7 * 24 * time.Hour); len(samples) >= baselineMinSamples {
+		return samples, true
+	}
+	return collect(24 * time.Hour), false
+}
+
+// returns the bucket of the last whole minute before ts, or nil if none
+func (p *rollups) lastMinute(ts time.Time) *rollupBucket {
+	start := ts.Truncate(time.Minute).Add(-time.Minute)
+	for _, tier := range p.tiers {
+		if tier.resolution != time.Minute {
+			continue
+		}
+		for _, bucket := range tier.series() {
+			if bucket.start.Equal(start) {
+				return bucket
+			}
+		}
+	}
+	return nil
+}
+
+// scores the last minute (as of ts) of traffic, error rate, and the given
+// routes. Returns nil while there is not enough history.
+func (p *rollups) anomalies(ts time.Time, routes []string) []anomaly {
+	samples, weekly := p.seasonal(ts)
+	last := p.lastMinute(ts)
+	if len(samples) < baselineMinSamples || last == nil {
+		return nil
+	}
+	score := func(name string, value func(*rollupBucket) float64, perMinute bool) anomaly {
+		var sum, sumsq float64
+		for _, bucket := range samples {
+			v := value(bucket)
+			if perMinute {
+				v /= 60
+			}
+			sum += v
+			sumsq += v * v
+		}
+		n := float64(len(samples))
+		mean := sum / n
+		stddev := math.Sqrt(math.Max(sumsq/n-mean*mean, 0))
+		/* floor the stddev, lest a steady baseline score noise as anomalous */
+		if perMinute {
+			stddev = math.Max(stddev, math.Max(math.Sqrt(mean), 1)) /* poisson */
+		} else {
+			stddev = math.Max(stddev, 0.01)
+		}
+		return anomaly{name, value(last), mean, stddev, len(samples), weekly}
+	}
+	anomalies := []anomaly{
+		score(anomalyTraffic, func(b *rollupBucket) float64 { return float64(b.counter.total) }, true),
+		score(anomalyErrors, func(b *rollupBucket) float64 { return b.counter.errorRate() }, false),
+	}
+	for _, route := range routes {
+		route := route
+		anomalies = append(anomalies, score(route, func(b *rollupBucket) float64 { return float64(b.routes[route]) }, true))
+	}
+	return anomalies
+}
@@ -0,0 +1,119 @@
+//    Copyright © 2016 Joubin Houshyar. All rights reserved.
+//
+//    This file is part of puppy.
+//
+//    puppy is free software: you can redistribute it and/or modify
+//    it under the terms of the GNU Affero General Public License as
+//    published by the Free Software Foundation, either version 3 of
+//    the License, or (at your option) any later version.
+//
+//    puppy is distributed in the hope that it will be useful,
+//    but WITHOUT ANY WARRANTY; without even the implied warranty of
+//    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//    GNU Affero General Public License for more details.
+//
+//    You should have received a copy of the GNU Affero General Public
+//    License along with puppy.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"math"
+	"sort"
+	"testing"
+	"time"
+)
+
+var baselineNow = time.Date(2026, 10, 14, 12, 30, 0, 0, time.UTC)
+
+// rollups with an hourly bucket of the counts per minute (and the /api
+// route, half the count) at each of the given days before baselineNow,
+// and a last minute bucket of lastMin, if any.
+func testRollups(perMinByDay map[int]uint, lastMin uint) *rollups {
+	p := newRollups()
+	hour := baselineNow.Truncate(time.Hour)
+	for _, tier := range p.tiers {
+		switch tier.resolution {
+		case time.Hour:
+			for day, perMin := range perMinByDay {
+				bucket := &rollupBucket{hour.AddDate(0, 0, -day), &accessCounter{total: 60 * perMin}, map[string]uint{"/api": 30 * perMin}}
+				bucket.counter.classes[5] = 6 * perMin /* 10% */
+				tier.buckets.add(bucket)
+			}
+		case time.Minute:
+			if lastMin > 0 {
+				counter := &accessCounter{total: lastMin}
+				counter.classes[5] = lastMin / 10
+				tier.current = &rollupBucket{baselineNow.Add(-time.Minute), counter, map[string]uint{"/api": lastMin / 2}}
+			}
+		}
+	}
+	return p
+}
+
+func TestAnomaliesLearning(t *testing.T) {
+	if anomalies := testRollups(map[int]uint{1: 100, 2: 100}, 100).anomalies(baselineNow, nil); anomalies != nil {
+		t.Errorf("expected nil with 2 samples, got %v", anomalies)
+	}
+	if anomalies := testRollups(map[int]uint{1: 100, 2: 100, 3: 100}, 0).anomalies(baselineNow, nil); anomalies != nil {
+		t.Errorf("expected nil without a last minute, got %v", anomalies)
+	}
+}
+
+func TestAnomaliesSeasonality(t *testing.T) {
+	tests := []struct {
+		name        string
+		perMinByDay map[int]uint
+		weekly      bool
+		samples     int
+		mean        float64
+	}{
+		{"daily fallback", map[int]uint{1: 100, 2: 100, 3: 100, 4: 100}, false, 4, 100},
+		{"weekly", map[int]uint{1: 50, 2: 50, 3: 50, 7: 200, 14: 200, 21: 200}, true, 3, 200},
+	}
+	for _, test := range tests {
+		anomalies := testRollups(test.perMinByDay, 100).anomalies(baselineNow, []string{"/api"})
+		if len(anomalies) != 3 {
+			t.Fatalf("%s - expected traffic, errors and a route, got %v", test.name, anomalies)
+		}
+		traffic := anomalies[0]
+		if traffic.name != anomalyTraffic || traffic.weekly != test.weekly || traffic.samples != test.samples || traffic.mean != test.mean {
+			t.Errorf("%s - got %+v", test.name, traffic)
+		}
+		if route := anomalies[2]; route.name != "/api" || route.mean != test.mean/2 || route.current != 50 {
+			t.Errorf("%s - route %+v", test.name, route)
+		}
+	}
+}
+
+func TestAnomaliesStddevFloor(t *testing.T) {
+	steady := map[int]uint{1: 100, 2: 100, 3: 100}
+	anomalies := testRollups(steady, 130).anomalies(baselineNow, []string{"/api", "/gone"})
+	traffic, errors, gone := anomalies[0], anomalies[1], anomalies[3]
+	if traffic.stddev != 10 || traffic.z() != 3 { /* poisson, sqrt(100) */
+		t.Errorf("traffic - expected stddev 10 and z 3, got %+v", traffic)
+	}
+	if errors.stddev != 0.01 || math.Abs(errors.z()) > 1e-9 {
+		t.Errorf("errors - expected stddev 0.01 and z 0, got %+v", errors)
+	}
+	if gone.mean != 0 || gone.stddev != 1 || gone.current != 0 { /* floored at 1 */
+		t.Errorf("unseen route - got %+v", gone)
+	}
+}
+
+func TestTopEntries(t *testing.T) {
+	var entries []namedCounter
+	for i, total := range []uint{5, 9, 1, 7, 9, 3, 12, 2} {
+		entries = append(entries, namedCounter{string(rune('a' + i)), &accessCounter{total: total}})
+	}
+	entries = append(entries, namedCounter{otherKey, &accessCounter{total: 100}})
+	for _, sorted := range []bool{false, true} {
+		if sorted {
+			sort.Sort(ByTotal(entries))
+		}
+		top := topEntries(entries, 3)
+		if len(top) != 3 || top[0].counter.total != 12 || top[1].counter.total != 9 || top[2].counter.total != 9 {
+			t.Errorf("sorted %t - got %v", sorted, top)
+		}
+	}
+}
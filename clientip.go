@@ -0,0 +1,110 @@
+//    Copyright © 2016 Joubin Houshyar. All rights reserved.
+//
+//    This file is part of puppy.
+//
+//    puppy is free software: you can redistribute it and/or modify
+//    it under the terms of the GNU Affero General Public License as
+//    published by the Free Software Foundation, either version 3 of
+//    the License, or (at your option) any later version.
+//
+//    puppy is distributed in the hope that it will be useful,
+//    but WITHOUT ANY WARRANTY; without even the implied warranty of
+//    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//    GNU Affero General Public License for more details.
+//
+//    You should have received a copy of the GNU Affero General Public
+//    License along with puppy.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+// General note:
+// Behind proxies and load balancers the remote host is the last proxy.
+// If the log format includes an X-Forwarded-For (or X-Real-IP) field
+// (c.f. conf.clientIpField) the client address is taken to be the right
+// most address of the chain (remote host last) that is not a trusted
+// proxy. Anything to the left of the first untrusted address may be
+// spoofed by the client, so is not considered.
+
+// default trusted proxies are the private, loopback and link-local ranges
+const defaultTrustedProxies = "127.0.0.0/8,10.0.0.0/8,172.16.0.0/12,192.168.0.0/16,169.254.0.0/16,::1/128,fc00::/7,fe80::/10"
+
+type proxyList []*net.IPNet
+
+// trusted proxy networks. Set from conf.trustedProxies on startup.
+var trustedProxies proxyList
+
+// parses a comma separated list of CIDRs and/or bare addresses.
+func parseProxyList(csv string) (proxyList, error) {
+	var list proxyList
+	for _, s := range strings.Split(csv, ",") {
+		if s = strings.TrimSpace(s); s == "" {
+			continue
+		}
+		if !strings.Contains(s, "/") {
+			ip := net.ParseIP(s)
+			if ip == nil {
+				return nil, fmt.Errorf("err - parseProxyList - invalid address %q", s)
+			}
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 8*net.IPv4len
+			}
+			list = append(list, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, network, e := net.ParseCIDR(s)
+		if e != nil {
+			return nil, fmt.Errorf("err - parseProxyList - %s", e.Error())
+		}
+		list = append(list, network)
+	}
+	return list, nil
+}
+
+// returns true if addr is an IP address in any of the trusted networks.
+func (p proxyList) trusts(addr string) bool {
+	ip := net.ParseIP(stripPort(addr))
+	if ip == nil {
+		return false
+	}
+	for _, network := range p {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// returns the client address per the remote host and the forwarded-for
+// field (a comma separated list, left most being the originating client).
+// If all addresses are trusted, the left most is the client.
+func clientAddr(remote, forwarded string, trusted proxyList) string {
+	chain := []string{}
+	for _, addr := range strings.Split(forwarded, ",") {
+		if addr = strings.TrimSpace(addr); addr != "" && addr != "-" && addr != "unknown" {
+			chain = append(chain, addr)
+		}
+	}
+	chain = append(chain, remote)
+	for n := len(chain) - 1; n >= 0; n-- {
+		if !trusted.trusts(chain[n]) {
+			return stripPort(chain[n])
+		}
+	}
+	return stripPort(chain[0])
+}
+
+// drops the port of host:port and [ipv6]:port forms, and the brackets
+// of [ipv6]. Bare IPv6 addresses are returned as is.
+func stripPort(addr string) string {
+	if host, _, e := net.SplitHostPort(addr); e == nil {
+		return host
+	}
+	return strings.TrimSuffix(strings.TrimPrefix(addr, "["), "]")
+}
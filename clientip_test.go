@@ -0,0 +1,89 @@
+// friend
+
+//    Copyright © 2016 Joubin Houshyar. All rights reserved.
+//
+//    This file is part of puppy.
+//
+//    puppy is free software: you can redistribute it and/or modify
+//    it under the terms of the GNU Affero General Public License as
+//    published by the Free Software Foundation, either version 3 of
+//    the License, or (at your option) any later version.
+//
+//    puppy is distributed in the hope that it will be useful,
+//    but WITHOUT ANY WARRANTY; without even the implied warranty of
+//    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//    GNU Affero General Public License for more details.
+//
+//    You should have received a copy of the GNU Affero General Public
+//    License along with puppy.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import "testing"
+
+func TestClientAddr(t *testing.T) {
+	trusted, e := parseProxyList(defaultTrustedProxies + ", 203.0.113.7")
+	if e != nil {
+		t.Fatal(e)
+	}
+	tests := []struct {
+		name, remote, forwarded, client string
+	}{
+		{"no header", "10.0.0.1", "", "10.0.0.1"},
+		{"dash header", "10.0.0.1", "-", "10.0.0.1"},
+		{"blank entries", "10.0.0.1", " , ,unknown", "10.0.0.1"},
+		{"one hop", "10.0.0.1", "198.51.100.4", "198.51.100.4"},
+		{"spoofed leftmost", "10.0.0.1", "1.2.3.4, 198.51.100.4", "198.51.100.4"},
+		{"spoofed trusted leftmost", "10.0.0.1", "10.9.9.9, 198.51.100.4, 192.168.1.1", "198.51.100.4"},
+		{"trusted bare address", "10.0.0.1", "198.51.100.4, 203.0.113.7", "198.51.100.4"},
+		{"all hops trusted", "10.0.0.1", "192.168.1.5, 172.16.0.1", "192.168.1.5"},
+		{"untrusted direct peer", "198.51.100.9", "1.2.3.4", "198.51.100.9"},
+		{"untrusted direct peer with port", "198.51.100.9:4711", "1.2.3.4", "198.51.100.9"},
+		{"malformed hop", "10.0.0.1", "1.2.3.4, not-an-ip", "not-an-ip"},
+		{"malformed trailing garbage", "10.0.0.1", "1.2.3.4,,", "1.2.3.4"},
+		{"client port", "10.0.0.1", "198.51.100.4:5123", "198.51.100.4"},
+		{"ipv6 client", "10.0.0.1", "2001:db8::1", "2001:db8::1"},
+		{"bracketed ipv6 client with port", "10.0.0.1", "[2001:db8::1]:443", "2001:db8::1"},
+		{"ipv6 trusted proxy", "::1", "2001:db8::2, fd00::1", "2001:db8::2"},
+		{"ipv6 link-local peer", "fe80::1", "198.51.100.4", "198.51.100.4"},
+	}
+	for _, test := range tests {
+		if client := clientAddr(test.remote, test.forwarded, trusted); client != test.client {
+			t.Errorf("%s - got %q, expected %q", test.name, client, test.client)
+		}
+	}
+}
+
+func TestParseProxyList(t *testing.T) {
+	tests := []struct {
+		csv     string
+		n       int
+		err     bool
+		trusts  []string
+		refuses []string
+	}{
+		{"", 0, false, nil, []string{"10.0.0.1"}},
+		{"10.0.0.0/8", 1, false, []string{"10.1.2.3", "10.1.2.3:80"}, []string{"11.0.0.1", "x"}},
+		{" 192.0.2.1 , 2001:db8::/32 ", 2, false, []string{"192.0.2.1", "[2001:db8::5]:443"}, []string{"192.0.2.2", "2001:db9::1"}},
+		{"::1", 1, false, []string{"::1"}, []string{"::2", "127.0.0.1"}},
+		{"10.0.0.0/33", 0, true, nil, nil},
+		{"not-an-ip", 0, true, nil, nil},
+	}
+	for _, test := range tests {
+		list, e := parseProxyList(test.csv)
+		if (e != nil) != test.err || len(list) != test.n {
+			t.Errorf("%q - got %d networks, error %v", test.csv, len(list), e)
+			continue
+		}
+		for _, addr := range test.trusts {
+			if !list.trusts(addr) {
+				t.Errorf("%q - expected %s trusted", test.csv, addr)
+			}
+		}
+		for _, addr := range test.refuses {
+			if list.trusts(addr) {
+				t.Errorf("%q - expected %s untrusted", test.csv, addr)
+			}
+		}
+	}
+}
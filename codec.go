@@ -20,15 +20,20 @@
 package main
 
 import (
+	"bytes"
 	"fmt"
 	"net/url"
+	"strconv"
+	"strings"
+	"time"
 )
 
 // nod toward possible multi-format extensions
 // not used.
 type parseFn func([]byte) (map[string]string, error)
 
-// structure captures the basic w3c Common Log Format.
+// structure captures the basic w3c Common Log Format, and the optional
+// referer and user-agent of the Combined Log Format.
 type logEntry struct {
 	remoteHost string
 	rfc931     string
@@ -41,6 +46,16 @@ type logEntry struct {
 	status     uint
 	bytes      uint
 	uri        *url.URL
+	referer    string // "" if not present
+	userAgent  string // "" if not present
+	extra      []string
+	duration   time.Duration // c.f. conf.durationField
+	timed      bool          // true if duration is present
+	vhost      string        // c.f. conf.vhostPrefix & conf.vhostField
+	clientHost string        // c.f. conf.clientIpField, "" if not present
+
+	agent  *userAgent // lazily classified (c.f. classify)
+	routed string     // lazily normalized (c.f. route)
 }
 
 func (p *logEntry) section() string {
@@ -55,39 +70,322 @@ func (p *logEntry) section() string {
 	return path
 }
 
+// the client address of the entry, which is the remote host unless the
+// request was forwarded (c.f. clientAddr).
+func (p *logEntry) host() string {
+	if p.clientHost != "" {
+		return p.clientHost
+	}
+	return p.remoteHost
+}
+
+// returns the n-th (1-based) extra field. ok is false if n is 0 or if
+// the entry has fewer extra fields.
+func (p *logEntry) extraField(n uint) (field string, ok bool) {
+	if n == 0 || n > uint(len(p.extra)) {
+		return "", false
+	}
+	return p.extra[n-1], true
+}
+
+// the resource key of the entry, which is either the route template
+// (if routes are configured) or the section.
+func (p *logEntry) resource() string {
+	if routes != nil {
+		return routes.normalize(p.uri.Path)
+	}
+	return p.section()
+}
+
+// route templates of the 'route' field if -by-route is not in effect
+var defaultRoutes = newRouteNormalizer(true)
+
+// returns the (cached) route template of the access, per the configured
+// routes, or else the built-in rules.
+func (p *logEntry) route() string {
+	if p.routed == "" {
+		if routes != nil {
+			p.routed = routes.normalize(p.uri.Path)
+		} else {
+			p.routed = defaultRoutes.normalize(p.uri.Path)
+		}
+	}
+	return p.routed
+}
+
 // function attempts parse of provided line.
 // 'entry' is always nil in case of errors.
 // 'entry' is nil if line is a comment (in which case error will be nil).
+//
+// The layout is the canonical
+//
+//    host ident user [date tmz] "request" status bytes
+//
+// but real-world logs (Apache & nginx) take liberties with nearly every
+// field, so rather than a fixed Sscanf layout, the line is tokenized (c.f.
+// fieldScanner) and each field is then interpreted leniently:
+//
+//    - host may be IPv6 (e.g. 2001:db8::1 or [::1])
+//    - tmz may be of any length (or missing)
+//    - request may contain spaces and escaped quotes (\", \\, \xhh), may
+//      lack the protocol (HTTP/0.9 "GET /"), or may be garbage (e.g. "-"
+//      on nginx 400s) in which case method is the raw request and address
+//      is empty.
+//    - status and bytes may be '-' (treated as 0).
+//
+// If the fields following bytes are quoted, they are taken to be the
+// Combined Log Format referer and user-agent. Any other trailing fields
+// are collected as 'extra' fields, e.g. the request duration (c.f.
+// conf.durationField).
+//
+// See testdata/clf-edgecases.log for a (hopefully growing) corpus of
+// the nasties.
 func parseW3cCommonLogFormat(line []byte) (entry *logEntry, err error) {
+	withError := func(fmtstr string, args ...interface{}) (*logEntry, error) {
+		return nil, fmt.Errorf("err - parseW3cCommonLogFormat - "+fmtstr, args...)
+	}
 	if len(line) == 0 { /* ignore but possible bug */
-		err = fmt.Errorf("err - parseW3cCommonLogFormat - unexpected zero-len input")
-		return
+		return withError("unexpected zero-len input")
 	}
 	if line[0] == '#' { /* ignore log directives & meta-data for now */
 		return
 	}
-	entry = &logEntry{}
-	n, e := fmt.Sscanf(string(line), "%s %s %s [%s %5s] \"%s %s %8s\" %d %d",
-		&entry.remoteHost,
-		&entry.rfc931,
-		&entry.user,
-		&entry.date,
-		&entry.tmz,
-		&entry.method,
-		&entry.address,
-		&entry.protocol,
-		&entry.status,
-		&entry.bytes)
-	if e != nil {
-		err = fmt.Errorf("ERR - parseW3cCommonLogFormat - n:%d e:%s\n", n, e.Error())
-		return
+
+	scanner := newFieldScanner(line)
+	var vhost string
+	if conf.vhostPrefix { /* e.g. Apache vhost_combined %v:%p */
+		field, e := scanner.next()
+		if e != nil {
+			return withError("vhost - %s", e.Error())
+		}
+		vhost = normalizeVhost(field)
 	}
-	/* verify here */
-	entry.uri, e = url.Parse(entry.address)
-	if e != nil {
-		err = fmt.Errorf("ERR - parseW3cCommonLogFormat - url.Parse - e:%s\n", e.Error())
-		return
+
+	var fields [7]string
+	for i := range fields {
+		field, e := scanner.next()
+		if e != nil {
+			return withError("field:%d - %s", i, e.Error())
+		}
+		fields[i] = field
+	}
+
+	entry = &logEntry{
+		remoteHost: fields[0],
+		rfc931:     fields[1],
+		user:       fields[2],
+		vhost:      vhost,
+	}
+	entry.date, entry.tmz = splitTimestamp(fields[3])
+	entry.method, entry.address, entry.protocol = splitRequestLine(fields[4])
+
+	var e error
+	if entry.status, e = parseUintField(fields[5]); e != nil {
+		return withError("status - %s", e.Error())
+	}
+	if entry.bytes, e = parseUintField(fields[6]); e != nil {
+		return withError("bytes - %s", e.Error())
 	}
 
+	/* malformed addresses are kept verbatim rather than rejected */
+	if entry.uri, e = url.Parse(entry.address); e != nil {
+		entry.uri = &url.URL{Path: entry.address}
+	}
+
+	/* combined log format */
+	for _, field := range []*string{&entry.referer, &entry.userAgent} {
+		if !scanner.atQuoted() {
+			break
+		}
+		if *field, e = scanner.next(); e != nil {
+			return withError("combined - %s", e.Error())
+		}
+	}
+	for scanner.more() {
+		field, e := scanner.next()
+		if e != nil {
+			return withError("extra:%d - %s", len(entry.extra)+1, e.Error())
+		}
+		entry.extra = append(entry.extra, field)
+	}
+
+	if field, ok := entry.extraField(conf.durationField); ok {
+		entry.duration, entry.timed, e = parseDuration(field, durationUnits[conf.durationUnit])
+		if e != nil {
+			return withError("duration - %s", e.Error())
+		}
+	}
+	if field, ok := entry.extraField(conf.vhostField); ok { /* e.g. nginx $host */
+		entry.vhost = normalizeVhost(field)
+	}
+	if field, ok := entry.extraField(conf.clientIpField); ok { /* X-Forwarded-For */
+		entry.clientHost = clientAddr(entry.remoteHost, field, trustedProxies)
+	}
+
+	return entry, nil
+}
+
+// vhosts are case insensitive, and the port (if any) is dropped, e.g.
+// 'Example.com:443' is 'example.com'. '-' is no vhost.
+func normalizeVhost(s string) string {
+	if s == "-" {
+		return ""
+	}
+	if n := strings.LastIndexByte(s, ':'); n > 0 && s[n-1] != ':' && isNumericId(s[n+1:]) {
+		if strings.IndexByte(s, ':') == n || s[n-1] == ']' { /* not a bare IPv6 address */
+			s = s[:n]
+		}
+	}
+	return strings.ToLower(s)
+}
+
+// splits the bracketed timestamp (sans brackets) at the last space,
+// e.g. '10/Oct/2000:13:55:36 -0700'. tmz is "" if not present.
+func splitTimestamp(s string) (date, tmz string) {
+	if n := strings.LastIndexByte(s, ' '); n > 0 {
+		return s[:n], s[n+1:]
+	}
+	return s, ""
+}
+
+// splits the (unquoted) request line into its method, address and
+// protocol. The address is everything between the method and protocol,
+// so embedded spaces are preserved. The protocol is optional (HTTP/0.9).
+// A single token request (e.g. '-' or binary junk) is returned as the
+// method, with empty address and protocol.
+func splitRequestLine(s string) (method, address, protocol string) {
+	s = strings.TrimSpace(s)
+	n := strings.IndexByte(s, ' ')
+	if n < 0 {
+		return s, "", ""
+	}
+	method, address = s[:n], strings.TrimSpace(s[n+1:])
+	if n = strings.LastIndexByte(address, ' '); n > 0 && isProtocol(address[n+1:]) {
+		address, protocol = strings.TrimSpace(address[:n]), address[n+1:]
+	} else if isProtocol(address) {
+		/* e.g. "GET HTTP/1.1" - clients do send these */
+		address, protocol = "", address
+	}
 	return
 }
+
+// protocols are of form NAME/version, e.g. HTTP/1.1, HTTP/2.0, RTSP/1.0
+func isProtocol(s string) bool {
+	n := strings.IndexByte(s, '/')
+	if n < 1 || n == len(s)-1 {
+		return false
+	}
+	for _, b := range []byte(s[:n]) {
+		if (b < 'A' || b > 'Z') && (b < 'a' || b > 'z') {
+			return false
+		}
+	}
+	return true
+}
+
+// '-' is the CLF convention for no value and is treated as 0.
+func parseUintField(s string) (uint, error) {
+	if s == "-" {
+		return 0, nil
+	}
+	v, e := strconv.ParseUint(s, 10, 0)
+	if e != nil {
+		return 0, e
+	}
+	return uint(v), nil
+}
+
+// ----------------------------------------------------------------------
+// field scanner
+
+// fieldScanner tokenizes a log line into space delimited fields. A field
+// may be "quoted" (with Apache/nginx style \ escapes), or [bracketed],
+// in which case the delimiters are stripped and embedded spaces kept.
+type fieldScanner struct {
+	line []byte
+	xof  int
+}
+
+// a trailing '\r' (CRLF logs) is dropped as tail only strips the '\n'.
+func newFieldScanner(line []byte) *fieldScanner {
+	line = bytes.TrimSuffix(line, []byte{'\r'})
+	return &fieldScanner{line, 0}
+}
+
+// returns true if there are remaining (non-space) bytes in the line.
+func (s *fieldScanner) more() bool {
+	s.skipSpaces()
+	return s.xof < len(s.line)
+}
+
+// returns true if the next field is quoted.
+func (s *fieldScanner) atQuoted() bool {
+	return s.more() && s.line[s.xof] == '"'
+}
+
+func (s *fieldScanner) skipSpaces() {
+	for s.xof < len(s.line) && (s.line[s.xof] == ' ' || s.line[s.xof] == '\t') {
+		s.xof++
+	}
+}
+
+// returns the next field. Returns error on end of line or if a quoted
+// or bracketed field is not terminated.
+func (s *fieldScanner) next() (string, error) {
+	if !s.more() {
+		return "", fmt.Errorf("unexpected end of line")
+	}
+	switch s.line[s.xof] {
+	case '"':
+		return s.quoted()
+	case '[':
+		n := bytes.IndexByte(s.line[s.xof:], ']')
+		if n < 0 {
+			return "", fmt.Errorf("unterminated [")
+		}
+		/* e.g. [::1]:80 is not bracketed but a plain field */
+		if end := s.xof + n + 1; end == len(s.line) || s.line[end] == ' ' || s.line[end] == '\t' {
+			field := string(s.line[s.xof+1 : s.xof+n])
+			s.xof = end
+			return field, nil
+		}
+	}
+	start := s.xof
+	for s.xof < len(s.line) && s.line[s.xof] != ' ' && s.line[s.xof] != '\t' {
+		s.xof++
+	}
+	return string(s.line[start:s.xof]), nil
+}
+
+// reads a quoted field, resolving \", \\ and \xhh escapes. Any other
+// escape sequence is kept verbatim.
+func (s *fieldScanner) quoted() (string, error) {
+	var buf []byte
+	for i := s.xof + 1; i < len(s.line); i++ {
+		b := s.line[i]
+		switch {
+		case b == '"':
+			s.xof = i + 1
+			return string(buf), nil
+		case b == '\\' && i+1 < len(s.line):
+			switch s.line[i+1] {
+			case '"', '\\':
+				buf = append(buf, s.line[i+1])
+				i++
+				continue
+			case 'x':
+				if i+3 < len(s.line) {
+					if v, e := strconv.ParseUint(string(s.line[i+2:i+4]), 16, 8); e == nil {
+						buf = append(buf, byte(v))
+						i += 3
+						continue
+					}
+				}
+			}
+			buf = append(buf, b)
+		default:
+			buf = append(buf, b)
+		}
+	}
+	return "", fmt.Errorf("unterminated \"")
+}
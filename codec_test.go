@@ -0,0 +1,187 @@
+// friend
+
+//    Copyright © 2016 Joubin Houshyar. All rights reserved.
+//
+//    This file is part of puppy.
+//
+//    puppy is free software: you can redistribute it and/or modify
+//    it under the terms of the GNU Affero General Public License as
+//    published by the Free Software Foundation, either version 3 of
+//    the License, or (at your option) any later version.
+//
+//    puppy is distributed in the hope that it will be useful,
+//    but WITHOUT ANY WARRANTY; without even the implied warranty of
+//    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//    GNU Affero General Public License for more details.
+//
+//    You should have received a copy of the GNU Affero General Public
+//    License along with puppy.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"bufio"
+	"os"
+	"reflect"
+	"testing"
+)
+
+// the expected fields of a parsed line
+type parsed struct {
+	vhost, host, user, tmz    string
+	method, address, protocol string
+	status, bytes             uint
+	referer, userAgent        string
+	extra                     []string
+}
+
+func parsedOf(entry *logEntry) parsed {
+	return parsed{
+		entry.vhost, entry.remoteHost, entry.user, entry.tmz,
+		entry.method, entry.address, entry.protocol,
+		entry.status, entry.bytes,
+		entry.referer, entry.userAgent,
+		entry.extra,
+	}
+}
+
+// reads the non-comment lines of a corpus file
+func corpusLines(t *testing.T, fname string) []string {
+	file, e := os.Open(fname)
+	if e != nil {
+		t.Fatalf("open %s - %s", fname, e)
+	}
+	defer file.Close()
+	var lines []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if line := scanner.Text(); line != "" && line[0] != '#' {
+			lines = append(lines, line)
+		}
+	}
+	if e := scanner.Err(); e != nil {
+		t.Fatalf("read %s - %s", fname, e)
+	}
+	return lines
+}
+
+// the expected fields of each line of the corpus, in order
+var corpusTests = []struct {
+	fname       string
+	vhostPrefix bool
+	expected    []parsed
+}{
+	{"testdata/clf-edgecases.log", false, []parsed{
+		{"", "127.0.0.1", "frank", "-0700", "GET", "/apache_pb.gif", "HTTP/1.0", 200, 2326, "", "", nil},
+		{"", "10.0.0.7", "-", "-0700", "GET", "/index.html", "HTTP/1.1", 304, 0, "", "", nil},
+		{"", "10.0.0.7", "-", "-0700", "GET", "/slow", "HTTP/1.1", 0, 0, "", "", nil},
+		{"", "10.0.0.8", "-", "-0700", "GET", "/feed", "RTSP/1.0.1", 200, 512, "", "", nil},
+		{"", "10.0.0.8", "-", "-0700", "PRI", "*", "HTTP/2.0", 400, 0, "", "", nil},
+		{"", "10.0.0.9", "-", "-0700", "GET", "/", "", 200, 5, "", "", nil},
+		{"", "10.0.0.10", "-", "-0700", "GET", "/docs/my file.pdf", "HTTP/1.1", 404, 196, "", "", nil},
+		{"", "10.0.0.11", "-", "-0700", "GET", `/search?q="puppy"\x`, "HTTP/1.1", 200, 1024, "", "", nil},
+		{"", "10.0.0.11", "-", "+0000", "GET", `/search?q="puppy"`, "HTTP/1.1", 200, 1024, "", "", nil},
+		{"", "10.0.0.12", "-", "+0000", "-", "", "", 400, 0, "", "", nil},
+		{"", "10.0.0.12", "-", "+0000", "\x16\x03\x01\x00\xA5\x01\x00\x00\xA1\x03\x03", "", "", 400, 157, "", "", nil},
+		{"", "10.0.0.12", "-", "+0000", "", "", "", 408, 0, "", "", nil},
+		{"", "10.0.0.12", "-", "+0000", "GET", "", "HTTP/1.1", 400, 0, "", "", nil},
+		{"", "2001:db8::ff00:42:8329", "-", "-0700", "GET", "/v6", "HTTP/1.1", 200, 10, "", "", nil},
+		{"", "::1", "-", "-0700", "OPTIONS", "*", "HTTP/1.0", 200, 0, "", "", nil},
+		{"", "2001:db8::1", "-", "-0700", "GET", "/v6", "HTTP/1.1", 200, 10, "", "", nil},
+		{"", "10.0.0.13", "-", "+05:30", "GET", "/tz", "HTTP/1.1", 200, 1, "", "", nil},
+		{"", "10.0.0.13", "-", "Z", "GET", "/tz", "HTTP/1.1", 200, 1, "", "", nil},
+		{"", "10.0.0.13", "-", "", "GET", "/tz", "HTTP/1.1", 200, 1, "", "", nil},
+		{"", "10.0.0.14", "jane.doe@example.com", "-0700", "POST", "/login", "HTTP/1.1", 302, 0, "", "", nil},
+		{"", "10.0.0.15", "-", "-0700", "GET", "http://example.com/", "HTTP/1.1", 200, 100, "", "", nil},
+		{"", "10.0.0.15", "-", "-0700", "CONNECT", "example.com:443", "HTTP/1.1", 405, 0, "", "", nil},
+		{"", "10.0.0.16", "-", "-0700", "GET", "/%zz%%/x", "HTTP/1.1", 400, 0, "", "", nil},
+		{"", "10.0.0.17", "-", "-0700", "GET", "/tabs", "HTTP/1.1", 200, 3, "", "", nil},
+		{"", "10.0.0.18", "-", "-0700", "GET", "/c", "HTTP/1.1", 200, 3, "http://example.com/", "Mozilla/5.0 (X11; Linux x86_64)", nil},
+		{"", "10.0.0.19", "-", "-0700", "GET", "/t", "HTTP/1.1", 200, 3, "-", "curl/8.0", []string{"0.123"}},
+		{"", "10.0.0.19", "-", "-0700", "GET", "/t", "HTTP/1.1", 200, 3, "", "", []string{"123000"}},
+		{"", "10.0.0.1", "-", "-0700", "GET", "/x", "HTTP/1.1", 200, 3, "-", "curl/8.0", []string{"198.51.100.7, 10.1.2.3"}},
+	}},
+	{"testdata/vhost-combined.log", true, []parsed{
+		{"www.example.com", "10.0.0.20", "-", "-0700", "GET", "/v", "HTTP/1.1", 200, 3, "-", "curl/8.0", nil},
+		{"api.example.com", "10.0.0.20", "-", "-0700", "GET", "/v", "HTTP/1.1", 200, 3, "-", "curl/8.0", nil},
+		{"10.0.0.1", "10.0.0.20", "-", "-0700", "GET", "/v", "HTTP/1.1", 200, 3, "-", "curl/8.0", nil},
+		{"[2001:db8::1]", "10.0.0.20", "-", "-0700", "GET", "/v", "HTTP/1.1", 200, 3, "-", "curl/8.0", nil},
+	}},
+}
+
+// every line of the corpora parses, as is and with CRLF line endings
+func TestParseCorpus(t *testing.T) {
+	defer func(vhostPrefix bool) { conf.vhostPrefix = vhostPrefix }(conf.vhostPrefix)
+	for _, test := range corpusTests {
+		conf.vhostPrefix = test.vhostPrefix
+		lines := corpusLines(t, test.fname)
+		if len(lines) != len(test.expected) {
+			t.Fatalf("%s - %d lines, expected %d", test.fname, len(lines), len(test.expected))
+		}
+		for i, line := range lines {
+			for _, eol := range []string{"", "\r"} {
+				entry, e := parseW3cCommonLogFormat([]byte(line + eol))
+				if e != nil {
+					t.Errorf("%s:%d (eol %q) - %s", test.fname, i+1, eol, e)
+					continue
+				}
+				if got := parsedOf(entry); !reflect.DeepEqual(got, test.expected[i]) {
+					t.Errorf("%s:%d (eol %q)\n got: %#v\nwant: %#v", test.fname, i+1, eol, got, test.expected[i])
+				}
+			}
+		}
+	}
+}
+
+func TestParseLines(t *testing.T) {
+	defer func(vhostPrefix bool) { conf.vhostPrefix = vhostPrefix }(conf.vhostPrefix)
+	tests := []struct {
+		line        string
+		vhostPrefix bool
+		entry       bool // false if ignored (comments)
+		ok          bool
+	}{
+		{"# comment", false, false, true},
+		{"10.0.0.1 - - [10/Oct/2000:13:55:36 -0700] \"GET / HTTP/1.1\" 200 123\r", false, true, true},
+		{"example.com:80 10.0.0.1 - - [10/Oct/2000:13:55:36 -0700] \"GET / HTTP/1.1\" 200 -\r", true, true, true},
+		{"10.0.0.1 - - [10/Oct/2000:13:55:36 -0700] \"GET / HTTP/1.1\" 200 12\r3", false, false, false},
+		{"10.0.0.1 - - [10/Oct/2000:13:55:36 -0700] \"GET / HTTP/1.1\" 200", false, false, false},
+		{"10.0.0.1 - - [10/Oct/2000:13:55:36 -0700 \"GET / HTTP/1.1\" 200 1", false, false, false},
+		{"10.0.0.1 - - [10/Oct/2000:13:55:36 -0700] \"GET / HTTP/1.1 200 1", false, false, false},
+		{"", false, false, false},
+		{"\r", false, false, false},
+	}
+	for _, test := range tests {
+		conf.vhostPrefix = test.vhostPrefix
+		entry, e := parseW3cCommonLogFormat([]byte(test.line))
+		if (e == nil) != test.ok {
+			t.Errorf("%q - error %v, expected ok:%t", test.line, e, test.ok)
+		}
+		if (entry != nil) != test.entry {
+			t.Errorf("%q - entry %v, expected entry:%t", test.line, entry, test.entry)
+		}
+	}
+}
+
+func TestNormalizeVhost(t *testing.T) {
+	tests := []struct{ vhost, expected string }{
+		{"example.com", "example.com"},
+		{"Example.COM:443", "example.com"},
+		{"www.example.com:8080", "www.example.com"},
+		{"-", ""},
+		{"", ""},
+		{"example.com:", "example.com:"},
+		{"example.com:http", "example.com:http"},
+		{"10.0.0.1:80", "10.0.0.1"},
+		{"[::1]:8080", "[::1]"},
+		{"[FE80::1]", "[fe80::1]"},
+		{"::1", "::1"},
+		{"fe80::1:80", "fe80::1:80"}, /* bare IPv6, not a port */
+		{":80", ":80"},
+	}
+	for _, test := range tests {
+		if vhost := normalizeVhost(test.vhost); vhost != test.expected {
+			t.Errorf("%q - got %q, expected %q", test.vhost, vhost, test.expected)
+		}
+	}
+}
@@ -0,0 +1,226 @@
+//    Copyright © 2016 Joubin Houshyar. All rights reserved.
+//
+//    This file is part of puppy.
+//
+//    puppy is free software: you can redistribute it and/or modify
+//    it under the terms of the GNU Affero General Public License as
+//    published by the Free Software Foundation, either version 3 of
+//    the License, or (at your option) any later version.
+//
+//    puppy is distributed in the hope that it will be useful,
+//    but WITHOUT ANY WARRANTY; without even the implied warranty of
+//    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//    GNU Affero General Public License for more details.
+//
+//    You should have received a copy of the GNU Affero General Public
+//    License along with puppy.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// General note:
+// A dimension is a named grouping of access, per the key(s) it extracts
+// from a log entry, and measures keep a counter table for each. Besides
+// the built-in dimensions (which the views depend on), dimensions can be
+// declared in config (c.f. conf.dims) as any of the fields below, or a
+// composite of fields joined by '+', e.g. host+route or vhost+status-class.
+// Composite keys are the fields' keys joined by keySeparator, which can't
+// be confused with the spaces of keys (e.g. user agents), and are shown
+// joined by " | " (c.f. displayKey).
+
+// extracts the keys of an access. Entries with no keys (e.g. no vhost)
+// are not counted in the dimension.
+type keyFn func(*logEntry) []string
+
+// the separator of the keys of composite keys (the ASCII unit separator)
+const keySeparator = "\x1f"
+
+// returns the key as displayed, i.e. a composite key's keys joined by " | "
+func displayKey(key string) string {
+	return strings.Join(strings.Split(key, keySeparator), " | ")
+}
+
+func one(s string) []string { return []string{s} }
+
+// fields with no value aren't counted
+func optional(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return []string{s}
+}
+
+// the fields of which dimensions are composed. c.f. fieldKeys for the
+// n-th extra field.
+var fieldKeyFns = map[string]keyFn{
+	"resource":         func(p *logEntry) []string { return one(p.resource()) },
+	"section":          func(p *logEntry) []string { return one(p.section()) },
+	"path":             func(p *logEntry) []string { return one(p.uri.Path) },
+	"host":             func(p *logEntry) []string { return one(p.host()) },
+	"remote-host":      func(p *logEntry) []string { return one(p.remoteHost) },
+	"user":             func(p *logEntry) []string { return one(p.user) },
+	"ident":            func(p *logEntry) []string { return one(p.rfc931) },
+	"method":           func(p *logEntry) []string { return one(parseMethod(p.method).String()) },
+	"protocol":         func(p *logEntry) []string { return optional(p.protocol) },
+	"status":           func(p *logEntry) []string { return one(strconv.FormatUint(uint64(p.status), 10)) },
+	"status-class":     func(p *logEntry) []string { return one(fmt.Sprintf("%dxx", statusClass(p.status))) },
+	"vhost":            func(p *logEntry) []string { return optional(p.vhost) },
+	"referer":          func(p *logEntry) []string { return optional(p.referer) },
+	"referer-domain":   func(p *logEntry) []string { return one(p.refererDomain()) },
+	"external-referer": func(p *logEntry) []string { return optional(p.externalReferer()) },
+	"referer-landing": func(p *logEntry) []string {
+		if referer := p.externalReferer(); referer != "" {
+			return one(referer + " → " + p.route())
+		}
+		return nil
+	},
+	"user-agent": func(p *logEntry) []string { return optional(p.userAgent) },
+	"browser":    func(p *logEntry) []string { return one(p.classify().browser) },
+	"os":         func(p *logEntry) []string { return one(p.classify().os) },
+	"device":     func(p *logEntry) []string { return one(p.classify().device) },
+	"bot":        func(p *logEntry) []string { return optional(p.classify().bot) },
+	"param":      func(p *logEntry) []string { return paramKeys(p) },
+	"route":      func(p *logEntry) []string { return one(p.route()) },
+}
+
+// query params are only tracked if configured (c.f. conf.queryParams)
+func paramKeys(access *logEntry) []string {
+	if !conf.queryParams {
+		return nil
+	}
+	return queryKeys(access)
+}
+
+// returns the keyFn of the named field, which is either one of fieldKeyFns, or
+// extra:n for the n-th trailing field (c.f. logEntry.extraField)
+func fieldKeys(name string) (keyFn, error) {
+	if fn, ok := fieldKeyFns[name]; ok {
+		return fn, nil
+	}
+	if strings.HasPrefix(name, "extra:") {
+		n, e := strconv.ParseUint(name[len("extra:"):], 10, 0)
+		if e != nil || n == 0 {
+			return nil, fmt.Errorf("err - fieldKeys - invalid extra field %q", name)
+		}
+		return func(p *logEntry) []string {
+			field, _ := p.extraField(uint(n))
+			return optional(field)
+		}, nil
+	}
+	return nil, fmt.Errorf("err - fieldKeys - unknown field %q", name)
+}
+
+// ----------------------------------------------------------------------
+// dimensions
+
+type dimension struct {
+	name    string
+	keys    keyFn
+	bounded bool // c.f. conf.topK
+	timed   bool // latency is recorded per key, c.f. timedFields
+}
+
+// the fields of which dimensions record latency per key (c.f.
+// accessCounter.recordLatency), i.e. the per route percentiles. Other
+// dimensions only count, which keeps their counters small.
+var timedFields = map[string]bool{"resource": true, "route": true, "section": true, "path": true}
+
+// parses a (possibly composite) dimension spec, e.g. host+route
+func newDimension(spec string, bounded bool) (*dimension, error) {
+	var fns []keyFn
+	timed := false
+	for _, name := range strings.Split(spec, "+") {
+		name = strings.TrimSpace(name)
+		fn, e := fieldKeys(name)
+		if e != nil {
+			return nil, e
+		}
+		fns = append(fns, fn)
+		timed = timed || timedFields[name]
+	}
+	if len(fns) == 1 {
+		return &dimension{spec, fns[0], bounded, timed}, nil
+	}
+	composite := func(p *logEntry) []string {
+		keys := []string{""}
+		for i, fn := range fns {
+			var product []string
+			for _, prefix := range keys {
+				for _, key := range fn(p) {
+					if i > 0 {
+						key = prefix + keySeparator + key
+					}
+					product = append(product, key)
+				}
+			}
+			keys = product
+		}
+		return keys
+	}
+	return &dimension{spec, composite, bounded, timed}, nil
+}
+
+// the built-in dimensions (in table order). The high cardinality ones are
+// bounded.
+var builtinDimensions = []struct {
+	name    string
+	bounded bool
+}{
+	{"resource", true},
+	{"user", true},
+	{"host", true},
+	{"vhost", false},
+	{"status", false},
+	{"browser", false},
+	{"os", false},
+	{"device", false},
+	{"bot", false},
+	{"external-referer", true},
+	{"referer-landing", true},
+	{"param", false},
+}
+
+// the dimensions of measures. Set on startup (c.f. initDimensions).
+var dimensions []*dimension
+
+// returns the named dimension, or nil if not defined
+func findDimension(name string) *dimension {
+	for _, dim := range dimensions {
+		if dim.name == name {
+			return dim
+		}
+	}
+	return nil
+}
+
+// initializes dimensions with the built-ins and the comma separated user
+// defined dimensions. User defined dimensions are bounded.
+func initDimensions(csv string) error {
+	dimensions = nil
+	seen := make(map[string]bool)
+	for _, builtin := range builtinDimensions {
+		dim, e := newDimension(builtin.name, builtin.bounded)
+		if e != nil {
+			return e
+		}
+		dimensions = append(dimensions, dim)
+		seen[dim.name] = true
+	}
+	for _, spec := range strings.Split(csv, ",") {
+		if spec = strings.TrimSpace(spec); spec == "" || seen[spec] {
+			continue
+		}
+		dim, e := newDimension(spec, true)
+		if e != nil {
+			return e
+		}
+		dimensions = append(dimensions, dim)
+		seen[spec] = true
+	}
+	return nil
+}
@@ -0,0 +1,132 @@
+// friend
+
+//    Copyright © 2016 Joubin Houshyar. All rights reserved.
+//
+//    This file is part of puppy.
+//
+//    puppy is free software: you can redistribute it and/or modify
+//    it under the terms of the GNU Affero General Public License as
+//    published by the Free Software Foundation, either version 3 of
+//    the License, or (at your option) any later version.
+//
+//    puppy is distributed in the hope that it will be useful,
+//    but WITHOUT ANY WARRANTY; without even the implied warranty of
+//    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//    GNU Affero General Public License for more details.
+//
+//    You should have received a copy of the GNU Affero General Public
+//    License along with puppy.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+// initializes dimensions for the test, which are restored on cleanup
+func testDimensions(t testing.TB, csv string) {
+	t.Helper()
+	saved := dimensions
+	t.Cleanup(func() { dimensions = saved })
+	if e := initDimensions(csv); e != nil {
+		t.Fatal(e)
+	}
+}
+
+func TestNewDimension(t *testing.T) {
+	testUaRules(t)
+	saved := conf
+	t.Cleanup(func() { conf = saved })
+	conf.queryParams = true
+	access := &logEntry{remoteHost: "10.0.0.1", userAgent: "Mozilla/5.0 (X11)", method: "GET", status: 503,
+		uri: &url.URL{Path: "/api/users", RawQuery: "a=1&b=2"}, extra: []string{"0.5", "x y"}}
+	tests := []struct {
+		spec  string
+		keys  []string
+		timed bool
+	}{
+		{"status", []string{"503"}, false},
+		{"status-class", []string{"5xx"}, false},
+		{"vhost", nil, false}, /* optional */
+		{"route", []string{"/api/users"}, true},
+		{"extra:2", []string{"x y"}, false},
+		{"extra:3", nil, false},
+		{"host+status", []string{"10.0.0.1\x1f503"}, false},
+		{" host + status-class ", []string{"10.0.0.1\x1f5xx"}, false},
+		{"user-agent+route", []string{"Mozilla/5.0 (X11)\x1f/api/users"}, true},
+		{"host+vhost", nil, false}, /* no keys if any field has none */
+		{"status+param", []string{"503\x1f/api?a", "503\x1f/api?b"}, false},
+		{"param+status-class+host", []string{"/api?a\x1f5xx\x1f10.0.0.1", "/api?b\x1f5xx\x1f10.0.0.1"}, false},
+	}
+	for _, test := range tests {
+		dim, e := newDimension(test.spec, true)
+		if e != nil {
+			t.Errorf("%q - %v", test.spec, e)
+			continue
+		}
+		if keys := dim.keys(access); !reflect.DeepEqual(keys, test.keys) {
+			t.Errorf("%q - keys %q, expected %q", test.spec, keys, test.keys)
+		}
+		if dim.name != test.spec || !dim.bounded || dim.timed != test.timed {
+			t.Errorf("%q - %+v", test.spec, dim)
+		}
+	}
+	for _, spec := range []string{"", "nope", "host+nope", "host+", "extra:0", "extra:x", "extra:"} {
+		if _, e := newDimension(spec, false); e == nil {
+			t.Errorf("%q - expected an error", spec)
+		}
+	}
+}
+
+func TestDisplayKey(t *testing.T) {
+	tests := []struct{ key, displayed string }{
+		{"", ""},
+		{"/api users", "/api users"},
+		{"10.0.0.1\x1f/api", "10.0.0.1 | /api"},
+		{"a b\x1fc\x1fd", "a b | c | d"},
+	}
+	for _, test := range tests {
+		if displayed := displayKey(test.key); displayed != test.displayed {
+			t.Errorf("%q - %q, expected %q", test.key, displayed, test.displayed)
+		}
+	}
+}
+
+func TestInitDimensions(t *testing.T) {
+	saved := dimensions
+	t.Cleanup(func() { dimensions = saved })
+	if e := initDimensions(" host+route , status,, host+route,extra:1"); e != nil {
+		t.Fatal(e)
+	}
+	var names []string
+	for _, dim := range dimensions {
+		names = append(names, dim.name)
+	}
+	expected := []string{}
+	for _, builtin := range builtinDimensions {
+		expected = append(expected, builtin.name)
+	}
+	expected = append(expected, "host+route", "extra:1")
+	if !reflect.DeepEqual(names, expected) {
+		t.Errorf("dimensions %q, expected %q", names, expected)
+	}
+	for i, builtin := range builtinDimensions {
+		if dimensions[i].bounded != builtin.bounded {
+			t.Errorf("%s - bounded %t", builtin.name, dimensions[i].bounded)
+		}
+	}
+	if dim := findDimension("host+route"); dim == nil || !dim.bounded || !dim.timed {
+		t.Errorf("host+route - %+v", dim)
+	}
+	if findDimension("route") != nil {
+		t.Errorf("route isn't a dimension")
+	}
+	if e := initDimensions("host+route,nope"); e == nil {
+		t.Errorf("unknown field - expected an error")
+	}
+	if e := initDimensions(""); e != nil || len(dimensions) != len(builtinDimensions) {
+		t.Errorf("no user defined dimensions - %v, %d dimensions", e, len(dimensions))
+	}
+}
@@ -21,6 +21,8 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"sort"
+	"strings"
 	"time"
 )
 
@@ -39,7 +41,9 @@ import (
 // event model needs to be used, or the puppy model needs to become
 // concurrent (which is probably not a good idea ;)
 
-func init() {
+// called on startup (c.f. main). Not an init() so that the package can be
+// tested headless.
+func initDisplay() {
 	if e := checkForTerminal(); e != nil {
 		log.Fatal(e.Error())
 	}
@@ -64,25 +68,79 @@ const (
 	alertsView
 	logView
 	debugView
+	treeView
+	paramsView
+	sessionsView
+	sloView
+	totalsView
+	moversView
 )
 
 type view struct {
-	id   viewId
-	page uint // scroll state
+	id     viewId
+	page   uint // scroll state
+	cursor uint // selected row (of views supporting navigation)
 }
 
 var currentView view
 
+// expanded nodes (by path) of the section tree view. Persists across
+// snapshots and view switches.
+var treeExpanded = make(map[string]bool)
+
+// the attributes the stats view table can display (c.f. statistic.by),
+// with the selection cycled via setTableOptions. Set on startup to all
+// dimensions bar params, which have their own view.
+var tableAttributes []string
+var tableAttribute int
+
+// the attribute of the totals view table (c.f. totalsAttributes)
+var totalsAttribute int
+
+// the attribute and reference of the movers view table (c.f.
+// moversAttributes)
+var moversAttribute int
+var moversRef moversReference
+
+// the pivot path of the stats view table (c.f. pivot). The table shows
+// the recent accesses matching the filters if any.
+var pivotFilters []pivotFilter
+
+// filter applied to all attribute tables
+var tableFilter agentFilter
+
+// order of attribute tables, by requests or by bytes served
+type tableOrder byte
+
+const (
+	byRequests tableOrder = iota
+	byBytes
+)
+
+var tableSort tableOrder
+
 func setView(event uiEvent) (e error) {
 	switch {
 	case event.is(viewStats):
-		currentView = view{statsView, 0}
+		currentView = view{id: statsView}
 	case event.is(viewAlerts):
-		currentView = view{alertsView, 0}
+		currentView = view{id: alertsView}
 	case event.is(viewLog):
-		currentView = view{logView, 0}
+		currentView = view{id: logView}
 	case event.is(viewDebug):
-		currentView = view{debugView, 0}
+		currentView = view{id: debugView}
+	case event.is(viewTree):
+		currentView = view{id: treeView}
+	case event.is(viewParams):
+		currentView = view{id: paramsView}
+	case event.is(viewSessions):
+		currentView = view{id: sessionsView}
+	case event.is(viewSlo):
+		currentView = view{id: sloView}
+	case event.is(viewTotals):
+		currentView = view{id: totalsView}
+	case event.is(viewMovers):
+		currentView = view{id: moversView}
 	default:
 		return fmt.Errorf("BUG - unknown uiEvent: %v", event)
 	}
@@ -100,6 +158,18 @@ func displayView() (e error) {
 		e = displayLog()
 	case debugView:
 		e = displayDebug()
+	case treeView:
+		e = displayTree()
+	case paramsView:
+		e = displayParams()
+	case sessionsView:
+		e = displaySessions()
+	case sloView:
+		e = displaySlo()
+	case totalsView:
+		e = displayTotals()
+	case moversView:
+		e = displayMovers()
 	}
 	return e
 }
@@ -128,6 +198,137 @@ func scrollView(event uiEvent) error {
 	return nil
 }
 
+// cycles the stats (or totals, or movers) table attribute, the humans/bots
+// filter, the table order, or the movers reference.
+func setTableOptions(event uiEvent) error {
+	switch {
+	case event.is(cycleTable) && currentView.id == totalsView:
+		totalsAttribute = (totalsAttribute + 1) % len(totalsAttributes)
+	case event.is(cycleTable) && currentView.id == moversView:
+		moversAttribute = (moversAttribute + 1) % len(moversAttributes)
+	case event.is(cycleReference):
+		moversRef = (moversRef + 1) % moversReferences
+	case event.is(cycleTable):
+		tableAttribute = (tableAttribute + 1) % len(tableAttributes)
+	case event.is(cycleFilter):
+		tableFilter = (tableFilter + 1) % (botsOnly + 1)
+	case event.is(cycleOrder):
+		tableSort = (tableSort + 1) % (byBytes + 1)
+	default:
+		return fmt.Errorf("BUG - unknown uiEvent: %v", event)
+	}
+	currentView.page = 0
+	currentView.cursor = 0
+	return refreshDisplay(true)
+}
+
+// moves the cursor, and expands/collapses the selected row, of views
+// that support navigation. Others simply ignore navigation events.
+func navigateView(event uiEvent) error {
+	switch currentView.id {
+	case statsView:
+		return navigateStatsTable(event)
+	case treeView:
+		return navigateTree(event)
+	}
+	return nil
+}
+
+// moves the cursor of the tree view, and expands/collapses the selected
+// section.
+func navigateTree(event uiEvent) error {
+	var visible []sectionRow
+	if stats := accessStatistic; stats != nil {
+		visible = stats.sections.visible(treeExpanded)
+	}
+	cnt := uint(len(visible))
+	if cnt == 0 {
+		return nil
+	}
+	if currentView.cursor >= cnt {
+		currentView.cursor = cnt - 1
+	}
+	selected := visible[currentView.cursor]
+
+	switch {
+	case event.is(cursorUp):
+		if currentView.cursor > 0 {
+			currentView.cursor--
+		}
+	case event.is(cursorDown):
+		if currentView.cursor < cnt-1 {
+			currentView.cursor++
+		}
+	case event.is(expandRow):
+		treeExpanded[selected.node.path] = true
+	case event.is(collapseRow):
+		// collapse the selection if expanded, otherwise its parent
+		if treeExpanded[selected.node.path] {
+			delete(treeExpanded, selected.node.path)
+			break
+		}
+		for n := int(currentView.cursor) - 1; n >= 0; n-- {
+			if visible[n].level < selected.level {
+				delete(treeExpanded, visible[n].node.path)
+				currentView.cursor = uint(n)
+				break
+			}
+		}
+	default:
+		return fmt.Errorf("BUG - unknown uiEvent: %v", event)
+	}
+	return displayView()
+}
+
+// moves the cursor of the stats view table, and pivots on the selected
+// row (expand), which filters the table by the selection and moves on to
+// the next attribute. Collapse pops the last pivot.
+func navigateStatsTable(event uiEvent) error {
+	stats := accessStatistic
+	if stats == nil {
+		return nil
+	}
+	_, data, _ := statsTable(stats)
+	inOrder := orderStats(data.inOrder, tableFilter, tableSort)
+	cnt := uint(len(inOrder))
+
+	switch {
+	case event.is(cursorUp):
+		if currentView.cursor > 0 {
+			currentView.cursor--
+		}
+	case event.is(cursorDown):
+		if currentView.cursor+1 < cnt {
+			currentView.cursor++
+		}
+	case event.is(expandRow):
+		if accessMetrics.recent == nil || currentView.cursor >= cnt {
+			beep()
+			return nil
+		}
+		attribute := tableAttributes[tableAttribute]
+		selected := inOrder[cnt-1-currentView.cursor]
+		pivotFilters = append(pivotFilters, pivotFilter{findDimension(attribute), selected.name})
+		tableAttribute = (tableAttribute + 1) % len(tableAttributes)
+		currentView.cursor = 0
+	case event.is(collapseRow):
+		n := len(pivotFilters)
+		if n == 0 {
+			return nil
+		}
+		for i, attribute := range tableAttributes {
+			if attribute == pivotFilters[n-1].dimension.name {
+				tableAttribute = i
+			}
+		}
+		pivotFilters = pivotFilters[:n-1]
+		currentView.cursor = 0
+	default:
+		return fmt.Errorf("BUG - unknown uiEvent: %v", event)
+	}
+	return refreshDisplay(true)
+}
+
 // ----------------------------------------------------------------------
 // views
 
@@ -179,54 +380,613 @@ func displayStats() error {
 		return fmt.Sprintf("%03.1f%%", v*100.)
 	}
 	/* traffic summary */
-	displayDatum0("requests", stats.accessCnt.total, 3, 1)
-	displayDatum("GET", pfmtr(stats.accessRatio.gets), 3, 24)
-	displayDatum("PUT", pfmtr(stats.accessRatio.puts), 3, 36)
-	displayDatum("POST", pfmtr(stats.accessRatio.posts), 3, 48)
-	displayDatum("DEL", pfmtr(stats.accessRatio.dels), 3, 61)
-	displayDatum("OTHER", pfmtr(stats.accessRatio.other), 3, 73)
+	row := uint(3)
+	displayDatum0("requests", stats.accessCnt.total, row, 1)
+	/* only the methods seen, as many as fit */
+	colx := uint(24)
+	for m, cnt := range stats.accessCnt.methods {
+		label := httpMethod(m).String()
+		width := uint(len(label)) + 10
+		if cnt == 0 || colx+width > cols {
+			continue
+		}
+		displayDatum(label, pfmtr(stats.accessRatio.methods[m]), row, colx)
+		colx += width
+	}
+	row++
+	/* smoothed request rates (c.f. ewmaRates) */
+	rates := stats.rates
+	displayDatum("req/s 1m/5m/15m", fmt.Sprintf("%.1f/%.1f/%.1f %s", rates[0], rates[1], rates[2], rates.trend()), row, 1)
+	row++
+	/* status classes */
+	displayDatum0("codes", len(stats.accessCnt.codes), row, 1)
+	for class := 2; class <= 5; class++ {
+		label := fmt.Sprintf("%dxx", class)
+		displayDatum(label, pfmtr(stats.accessRatio.classes[class]), row, 24+uint(class-2)*12)
+	}
+	row++
+	/* bandwidth */
+	displayDatum("bytes", bfmtr(float64(stats.accessCnt.bytes)), row, 1)
+	displayDatum("throughput", bfmtr(stats.throughput())+"/s", row, 24)
+	displayDatum("avg-size", bfmtr(float64(stats.accessCnt.avgBytes())), row, 48)
+	row++
 	/* aggregate and specific active resource, user, and host */
-	displayDatum0("resources", stats.byResource.total, 4, 1)
-	displayDatum("top-resource", stats.byResource.top, 4, 24)
-	displayDatum0("users", stats.byUser.total, 5, 1)
-	displayDatum("top-user", stats.byUser.top, 5, 24)
-	displayDatum0("hosts", stats.byHost.total, 6, 1)
-	displayDatum("top-host", stats.byHost.top, 6, 24)
+	displayDatum0("resources", stats.by("resource").total, row, 1)
+	displayDatum("top-resource", stats.by("resource").top, row, 24)
+	row++
+	displayDatum0("users", stats.by("user").total, row, 1)
+	displayDatum("top-user", stats.by("user").top, row, 24)
+	row++
+	displayDatum0("hosts", stats.by("host").total, row, 1)
+	displayDatum("top-host", stats.by("host").top, row, 24)
+	row++
+	/* unique counts of the sliding windows */
+	windows := make([]string, len(uniqueWindowMins))
+	for i, mins := range uniqueWindowMins {
+		windows[i] = spanfmtr(time.Duration(mins) * time.Minute)
+	}
+	displayDatum("uniques", strings.Join(windows, "/"), row, 1)
+	for attr := 0; attr < uniqueCount; attr++ {
+		counts := make([]string, len(stats.uniques))
+		for i, estimates := range stats.uniques {
+			counts[i] = fmt.Sprintf("%d", estimates[attr])
+		}
+		displayDatum(uniqueNames[attr], strings.Join(counts, "/"), row, 24+uint(attr)*20)
+	}
+	row++
+	/* traffic now vs then (c.f. rollups) */
+	for i, cmp := range stats.comparisons {
+		label := fmt.Sprintf("%s vs %s ago", spanfmtr(cmp.window), spanfmtr(cmp.ago))
+		value := "-"
+		if cmp.ok {
+			value = fmt.Sprintf("%d / %d (%+.1f%%)", cmp.current, cmp.then, cmp.change()*100.)
+		}
+		displayDatum(label, value, row, 1+uint(i)*40)
+	}
+	row++
+	/* deviation from the seasonal baseline (c.f. rollups.anomalies), as many as fit */
+	if len(stats.anomalies) == 0 {
+		displayDatum("baseline", "learning", row, 1)
+	} else {
+		label := "z (daily)"
+		if stats.anomalies[0].weekly {
+			label = "z (weekly)"
+		}
+		move(row, 1)
+		ttycmd(BOLD)
+		fmt.Printf("%s", label)
+		ttycmd(NORMTEXT)
+		colx := uint(len(label)) + 3
+		for _, a := range stats.anomalies {
+			datum := fmt.Sprintf("%s %+.1f", a.name, a.z())
+			if colx+uint(len(datum)) > cols {
+				break
+			}
+			move(row, colx)
+			fmt.Printf("%s", datum)
+			colx += uint(len(datum)) + 3
+		}
+	}
+	row++
+	/* user-agents */
+	displayDatum("bots", pfmtr(stats.accessRatio.bots), row, 1)
+	displayDatum("top-browser", stats.by("browser").top, row, 24)
+	displayDatum("top-os", stats.by("os").top, row, 48)
+	displayDatum("top-device", stats.by("device").top, row, 64)
+	row++
+	/* latency (c.f. conf.durationField) */
+	if conf.durationField > 0 {
+		latency := stats.latency
+		if latency == nil {
+			latency = &latencySummary{}
+		}
+		displayDatum("p50", dfmtr(latency.p50), row, 1)
+		displayDatum("p90", dfmtr(latency.p90), row, 24)
+		displayDatum("p99", dfmtr(latency.p99), row, 36)
+		displayDatum("max", dfmtr(latency.max), row, 48)
+		row++
+	}
 
-	fillRow(7, '-') /* REVU: let's go fully reto and draw lines */
+	fillRow(row, '-') /* REVU: let's go fully reto and draw lines */
+	row++
 
 	/// access by attribute /////////////////////////////////////////////
 
-	// REVU TODO tri-state flag in {resource, user, host} with default
-	//      TODO in which case factor our the generic table renderer
+	column, data, summary := statsTable(stats)
+	displayStatsTable(column, data, summary, row, true)
+
+	/* standard footer */
+	stdViewFooter()
+	return nil
+}
+
+// query params view (c.f. conf.queryParams)
+func displayParams() error {
+	ttycmds(HOME, CLEARSCREEN)
+	stdViewHeader("params", 2)
+
+	stats := accessStatistic
+	if stats == nil {
+		return nil
+	}
+	if !conf.queryParams {
+		move(3, 1)
+		fmt.Printf("query parameter tracking is off (c.f. options -query, -query-values)")
+	} else {
+		displayStatsTable("resource?param[=value]", stats.by("param"), stats.accessCnt, 3, false)
+	}
+
+	stdViewFooter()
+	return nil
+}
+
+// visitor sessions view (c.f. conf.sessionTimeoutMin)
+func displaySessions() error {
+	ttycmds(HOME, CLEARSCREEN)
+	stdViewHeader("sessions", 5)
+
+	stats := accessStatistic
+	if stats == nil {
+		return nil
+	}
+	sessions := stats.sessions
+	if sessions == nil {
+		move(3, 1)
+		fmt.Printf("session tracking is off (c.f. option -session-timeout)")
+		stdViewFooter()
+		return nil
+	}
+	displayDatum0("active", sessions.active, 3, 1)
+	displayDatum("new/min", fmt.Sprintf("%.1f", sessions.newPerMin), 3, 24)
+	displayDatum0("closed (1h)", sessions.closed, 4, 1)
+	displayDatum("avg-length", spanfmtr(sessions.avgLength.Truncate(time.Second)), 4, 24)
+	displayDatum("pages/session", fmt.Sprintf("%.1f", sessions.pagesPerSession), 4, 48)
+	fillRow(5, '-')
+
+	/* top landing and exit routes, side by side */
+	half := cols / 2
+	move(6, 1)
+	ttyfmt(fmt.Sprintf("%9s", "cnt"), BOLD, UNDERLINE)
+	move(6, 12)
+	ttyfmt("landing (1h)", BOLD, UNDERLINE)
+	move(6, half+1)
+	ttyfmt(fmt.Sprintf("%9s", "cnt"), BOLD, UNDERLINE)
+	move(6, half+12)
+	ttyfmt("exit (1h)", BOLD, UNDERLINE)
+	width := int(half) - 13
+	for n := uint(0); n+7 < rows; n++ {
+		if n < uint(len(sessions.landings)) {
+			item := sessions.landings[n]
+			move(n+7, 1)
+			fmt.Printf("%9d  %.*s", item.cnt, width, item.route)
+		}
+		if n < uint(len(sessions.exits)) {
+			item := sessions.exits[n]
+			move(n+7, half+1)
+			fmt.Printf("%9d  %.*s", item.cnt, width, item.route)
+		}
+	}
+
+	stdViewFooter()
+	return nil
+}
+
+// SLO view - apdex and availability by route, of the snapshot (now) and
+// the rolling window (c.f. conf.sloWindowMin), least budget first.
+func displaySlo() error {
+	ttycmds(HOME, CLEARSCREEN)
+	stdViewHeader("slo", 1)
+
+	stats := accessStatistic
+	if stats == nil {
+		return nil
+	}
+	afmtr := func(tally sloTally) string {
+		if score, ok := tally.apdex(); ok {
+			return fmt.Sprintf("%.2f", score)
+		}
+		return "-"
+	}
+	pfmtr := func(v float64) string {
+		return fmt.Sprintf("%.2f%%", v*100.)
+	}
+	window := spanfmtr(time.Duration(conf.sloWindowMin) * time.Minute)
+
+	/* table header */
+	header := []struct {
+		label string
+		col   uint
+	}{
+		{"T", 1}, {"apdex", 10}, {"apdex " + window, 18}, {"avail", 30},
+		{"avail " + window, 40}, {"target", 54}, {"budget", 64}, {"route", 74},
+	}
+	for _, h := range header {
+		move(3, h.col)
+		ttyfmt(h.label, BOLD, UNDERLINE)
+	}
+
+	/* view port */
+	sak := uint(4) // scroll adjust faktor
+	lim := min(viewportRows(sak), uint(len(stats.slos)))
+	for n := uint(0); n < lim; n++ {
+		status := &stats.slos[n]
+		move(n+sak, 1)
+		ttycmd(CLEARLINE)
+		if status.breach() != "" {
+			fgcolor(1)
+		}
+		fmt.Printf("%-8s %-7s %-11s %-9s %-13s %-9s %-9s %s",
+			dfmtr(status.objective.apdexT), afmtr(status.current), afmtr(status.window),
+			pfmtr(status.current.availability()), pfmtr(status.window.availability()),
+			pfmtr(status.objective.target), pfmtr(status.budget()), status.route)
+		ttycmd(NORMTEXT)
+	}
+
+	stdViewFooter()
+	return nil
+}
+
+// totals view - counts since start or reset (c.f. totals)
+func displayTotals() error {
+	ttycmds(HOME, CLEARSCREEN)
+	stdViewHeader("totals", 6)
+
+	totals := accessMetrics.totals
+	summary := totals.summary
+	row := uint(3)
+	displayDatum("since", totals.since.Format("15:04:05"), row, 1)
+	displayDatum("elapsed", spanfmtr(time.Since(totals.since).Truncate(time.Second)), row, 24)
+	displayDatum0("requests", summary.total, row, 48)
+	displayDatum("bytes", bfmtr(float64(summary.bytes)), row, 72)
+	row++
+	/* only the methods and codes seen, as many as fit */
+	colx := uint(1)
+	for m, cnt := range summary.methods {
+		label := httpMethod(m).String()
+		value := fmt.Sprintf("%d", cnt)
+		width := uint(len(label)+len(value)) + 4
+		if cnt == 0 || colx+width > cols {
+			continue
+		}
+		displayDatum(label, value, row, colx)
+		colx += width
+	}
+	row++
+	codes := make([]int, 0, len(summary.codes))
+	for code := range summary.codes {
+		codes = append(codes, int(code))
+	}
+	sort.Ints(codes)
+	colx = 1
+	for _, code := range codes {
+		label := fmt.Sprintf("%d", code)
+		value := fmt.Sprintf("%d", summary.codes[uint(code)])
+		width := uint(len(label)+len(value)) + 4
+		if colx+width > cols {
+			break
+		}
+		displayDatum(label, value, row, colx)
+		colx += width
+	}
+	row++
+	fillRow(row, '-')
+	row++
+
+	attribute := totalsAttributes[totalsAttribute]
+	displayStatsTable(attribute, totals.statsBy(attribute), summary, row, false)
+
+	stdViewFooter()
+	return nil
+}
+
+// movers view - keys with the largest change in requests vs the prior
+// snapshot or the window average (c.f. moversHistory)
+func displayMovers() error {
+	ttycmds(HOME, CLEARSCREEN)
+	stdViewHeader("movers", 3)
+
+	stats := accessStatistic
+	if stats == nil {
+		return nil
+	}
+	attribute := moversAttributes[moversAttribute]
+	reference := moversRef.String()
+	if moversRef == windowAverage {
+		reference = fmt.Sprintf("%s (%s)", reference, spanfmtr(time.Duration(conf.moversWindowMin)*time.Minute))
+	}
+	displayDatum("vs", reference, 3, 1)
+	displayDatum("by", attribute, 3, 48)
+	fillRow(4, '-')
+
+	movers := stats.movers[moversRef][attribute]
+	if movers == nil {
+		move(5, 1)
+		fmt.Printf("no reference yet (c.f. option -movers-window)")
+		stdViewFooter()
+		return nil
+	}
+
 	/* table header */
-	move(8, 1)
-	ttyfmt("req %%", BOLD, UNDERLINE)
-	move(8, 10)
+	header := []struct {
+		label string
+		col   uint
+	}{
+		{fmt.Sprintf("%9s", "delta"), 1}, {fmt.Sprintf("%8s", "change"), 12},
+		{fmt.Sprintf("%9s", "now"), 22}, {fmt.Sprintf("%9s", "then"), 33}, {attribute, 44},
+	}
+	for _, h := range header {
+		move(5, h.col)
+		ttyfmt(h.label, BOLD, UNDERLINE)
+	}
+
+	/* view port */
+	sak := uint(6) // scroll adjust faktor
+	lim := min(viewportRows(sak), uint(len(movers)))
+	width := int(cols) - 44
+	if width < 0 {
+		width = 0
+	}
+	for n := uint(0); n < lim; n++ {
+		item := movers[n]
+		change := fmt.Sprintf("%+.1f%%", item.change()*100.)
+		switch {
+		case item.isNew():
+			change = "new"
+		case item.isGone():
+			change = "gone"
+		}
+		move(n+sak, 1)
+		ttycmd(CLEARLINE)
+		if item.delta() > 0 {
+			fgcolor(2)
+		} else if item.delta() < 0 {
+			fgcolor(1)
+		}
+		fmt.Printf("%+9.1f  %8s  %9d  %9.1f  %.*s", item.delta(), change, item.current, item.prior,
+			width, item.name)
+		ttycmd(NORMTEXT)
+	}
+
+	stdViewFooter()
+	return nil
+}
+
+// returns the column, stats, and summary of the stats view table, which
+// is the selected attribute of the snapshot, or if pivoting, of the
+// recent accesses matching the pivot filters.
+func statsTable(stats *statistic) (string, *accessStats, *accessCounter) {
+	attribute := tableAttributes[tableAttribute]
+	if len(pivotFilters) == 0 {
+		return attribute, stats.by(attribute), stats.accessCnt
+	}
+	data, summary, e := accessMetrics.pivot(pivotFilters, attribute)
+	if e != nil {
+		panic(fmt.Sprintf("bug - statsTable - %s", e.Error()))
+	}
+	return pivotPath(pivotFilters) + " > " + attribute, data, summary
+}
+
+// renders the table of counts (in descending order) of the accessStats,
+// with the header at the given row, filling the view port. The columns
+// are per the tableFilter, and ratios relative to the (filtered) summary
+// count, but for rates which are only tracked for all agents, so aren't
+// shown if filtered. The row at the view cursor is highlighted if
+// selectable.
+func displayStatsTable(column string, data *accessStats, summary *accessCounter, row uint, selectable bool) {
+	pfmtr := func(v float64) string {
+		return fmt.Sprintf("%03.1f%%", v*100.)
+	}
+	total := summary.filtered(tableFilter)
+	/* table header */
+	move(row, 1)
+	ttyfmt("req %", BOLD, UNDERLINE)
+	move(row, 10)
 	ttyfmt("req cnt", BOLD, UNDERLINE)
-	move(8, 21)
-	ttyfmt("resource", BOLD, UNDERLINE)
+	move(row, 21)
+	ttyfmt("5xx %", BOLD, UNDERLINE)
+	move(row, 29)
+	ttyfmt(fmt.Sprintf("%8s", "bytes"), BOLD, UNDERLINE)
+	move(row, 39)
+	ttyfmt(fmt.Sprintf("%8s", "1m req/s"), BOLD, UNDERLINE)
+	colx := uint(51)
+	timed := conf.durationField > 0 && data.timed
+	if timed {
+		for _, label := range []string{"p50", "p90", "p99", "max"} {
+			move(row, colx)
+			ttyfmt(fmt.Sprintf("%8s", label), BOLD, UNDERLINE)
+			colx += 10
+		}
+	}
+	move(row, colx)
+	ttyfmt(column, BOLD, UNDERLINE)
+	if tableFilter != allAgents {
+		fmt.Printf(" ")
+		ttyfmt("("+tableFilter.String()+")", BOLD, REVERSE)
+	}
+	if tableSort == byBytes {
+		fmt.Printf(" ")
+		ttyfmt("(by bytes)", BOLD, REVERSE)
+	}
+	if data.k > 0 { /* bounded, c.f. topKTable */
+		fmt.Printf(" ")
+		ttyfmt(fmt.Sprintf("(top-%d ±%d)", data.k, data.maxErr), BOLD, REVERSE)
+	}
 
 	// view data
-	inOrder := stats.byResource.inOrder
+	inOrder := orderStats(data.inOrder, tableFilter, tableSort)
 
 	/* view port */
 	cnt := uint(len(inOrder))
 	xof := cnt - 1
-	sak := uint(9) // scroll adjust faktor
-	viewportLim := rows - sak
+	sak := row + 1 // scroll adjust faktor
+	viewportLim := viewportRows(sak)
+	if data.folded > 0 && viewportLim > 0 { /* table footer */
+		viewportLim--
+		move(rows-1, 1)
+		ttycmd(CLEARLINE)
+		ttyfmt(fmt.Sprintf("%d accesses of ~%d keys over the %d key cap counted as %s",
+			data.folded, data.foldedKeys, conf.maxKeys, otherKey), BOLD, REVERSE)
+	}
 	lim := min(viewportLim, cnt)
+	if selectable && lim > 0 && currentView.cursor >= lim {
+		currentView.cursor = lim - 1
+	}
 	for n := uint(0); n < lim; n++ {
 		move(n+sak, 1)
 		ttycmd(CLEARLINE)
 		ttycmd(NORMTEXT)
+		if selectable && n == currentView.cursor {
+			ttycmd(REVERSE)
+		}
 		item := inOrder[xof-n]
-		itemTotal := item.counter.total
-		itemRatio := float64(itemTotal) / float64(stats.accessCnt.total)
-		fmt.Printf("%5s  %9d    %s", pfmtr(itemRatio), itemTotal, item.name)
+		counter := item.counter.view(tableFilter)
+		itemRatio := 0.
+		if total > 0 {
+			itemRatio = float64(counter.total) / float64(total)
+		}
+		fmt.Printf("%5s  %9d    %5s   %8s  ", pfmtr(itemRatio), counter.total,
+			pfmtr(counter.errorRate()), bfmtr(float64(counter.bytes)))
+		if rates, ok := data.rates[item.name]; ok && tableFilter == allAgents {
+			fmt.Printf("%8.1f %s  ", rates[0], rates.trend())
+		} else {
+			fmt.Printf("%8s    ", "-")
+		}
+		if timed {
+			latency := counter.latency.summary()
+			if latency == nil {
+				latency = &latencySummary{}
+			}
+			fmt.Printf("%8s  %8s  %8s  %8s  ",
+				dfmtr(latency.p50), dfmtr(latency.p90), dfmtr(latency.p99), dfmtr(latency.max))
+		}
+		fmt.Printf("%s", displayKey(item.name))
+		ttycmd(NORMTEXT)
+	}
+}
+
+// bytes formatter - binary units with 1 decimal
+func bfmtr(v float64) string {
+	units := []string{"B", "KB", "MB", "GB", "TB"}
+	n := 0
+	for ; v >= 1024 && n < len(units)-1; n++ {
+		v /= 1024
+	}
+	if n == 0 {
+		return fmt.Sprintf("%.0f%s", v, units[n])
+	}
+	return fmt.Sprintf("%.1f%s", v, units[n])
+}
+
+// time span formatter - whole days, hours, minutes or seconds
+func spanfmtr(d time.Duration) string {
+	day := 24 * time.Hour
+	switch {
+	case d >= day && d%day == 0:
+		return fmt.Sprintf("%dd", d/day)
+	case d >= time.Hour && d%time.Hour == 0:
+		return fmt.Sprintf("%dh", d/time.Hour)
+	case d >= time.Minute && d%time.Minute == 0:
+		return fmt.Sprintf("%dm", d/time.Minute)
+	}
+	return fmt.Sprintf("%ds", d/time.Second)
+}
+
+// duration formatter - 3 significant digits is sufficient
+func dfmtr(d time.Duration) string {
+	switch {
+	case d == 0:
+		return "-"
+	case d < time.Millisecond:
+		return fmt.Sprintf("%dus", d/time.Microsecond)
+	case d < time.Second:
+		return fmt.Sprintf("%.1fms", float64(d)/float64(time.Millisecond))
+	}
+	return fmt.Sprintf("%.2fs", d.Seconds())
+}
+
+// returns the (ascending) order of counters per filter and order,
+// dropping the zero counts. inOrder is returned as is for allAgents
+// by requests.
+func orderStats(inOrder []namedCounter, filter agentFilter, order tableOrder) []namedCounter {
+	if filter == allAgents && order == byRequests {
+		return inOrder
+	}
+	filtered := make([]namedCounter, 0, len(inOrder))
+	for _, item := range inOrder {
+		if item.counter.filtered(filter) > 0 {
+			filtered = append(filtered, item)
+		}
+	}
+	sort.SliceStable(filtered, func(i, j int) bool {
+		if order == byBytes {
+			return filtered[i].counter.filteredBytes(filter) < filtered[j].counter.filteredBytes(filter)
+		}
+		return filtered[i].counter.filtered(filter) < filtered[j].counter.filtered(filter)
+	})
+	return filtered
+}
+
+// section tree view - drill-down per navigateView
+func displayTree() error {
+	ttycmds(HOME, CLEARSCREEN)
+	stdViewHeader("tree", 3)
+
+	stats := accessStatistic
+	if stats == nil {
+		return nil
+	}
+	pfmtr := func(v float64) string {
+		return fmt.Sprintf("%03.1f%%", v*100.)
+	}
+
+	/* table header */
+	move(3, 1)
+	ttyfmt("req %", BOLD, UNDERLINE)
+	move(3, 10)
+	ttyfmt("req cnt", BOLD, UNDERLINE)
+	move(3, 21)
+	ttyfmt("section", BOLD, UNDERLINE)
+
+	visible := stats.sections.visible(treeExpanded)
+	cnt := uint(len(visible))
+	if cnt > 0 && currentView.cursor >= cnt {
+		currentView.cursor = cnt - 1
+	}
+
+	/* view port - paged to keep the cursor in view */
+	sak := uint(4) // scroll adjust faktor
+	viewportLim := viewportRows(sak)
+	if viewportLim == 0 { /* no room for the tree */
+		stdViewFooter()
+		return nil
+	}
+	xof := (currentView.cursor / viewportLim) * viewportLim
+	lim := min(viewportLim, cnt-xof)
+	for n := uint(0); n < lim; n++ {
+		move(n+sak, 1)
+		ttycmd(CLEARLINE)
+		ttycmd(NORMTEXT)
+		row := visible[xof+n]
+		if xof+n == currentView.cursor {
+			ttycmd(REVERSE)
+		}
+		marker := " "
+		switch {
+		case len(row.node.children) == 0:
+		case treeExpanded[row.node.path]:
+			marker = "-"
+		default:
+			marker = "+"
+		}
+		itemTotal := row.node.counter.total
+		itemRatio := 0.
+		if total := stats.sections.root.counter.total; total > 0 {
+			itemRatio = float64(itemTotal) / float64(total)
+		}
+		fmt.Printf("%5s  %9d    %*s%s %s", pfmtr(itemRatio), itemTotal, 2*row.level, "", marker, row.node.name)
+		ttycmd(NORMTEXT)
 	}
 
-	/* standard footer */
 	stdViewFooter()
 	return nil
 }
@@ -324,11 +1084,24 @@ func stdViewHeader(view string, color int) {
 	ttyfmt(view, BOLD, codefmt(BGCOLOR, 8), codefmt(FGCOLOR, color))
 	move(1, 8)
 	ttyfmt(conf.fname, BOLD)
+	if accessMetrics.scope != "" {
+		fmt.Printf(" ")
+		ttyfmt("@"+accessMetrics.scope, BOLD, REVERSE)
+	}
 	moveJustified(1, tstr)
 	ttyfmt(tstr, BOLD, codefmt(FGCOLOR, 7))
 	fillRow(2, '-')
 }
 
+// returns the rows of a view port below sak header rows, 0 (rather than
+// underflow) if the terminal is too short
+func viewportRows(sak uint) uint {
+	if rows <= sak {
+		return 0
+	}
+	return rows - sak
+}
+
 func min(a, b uint) uint {
 	if a > b {
 		return b
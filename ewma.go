@@ -0,0 +1,140 @@
+//    Copyright © 2016 Joubin Houshyar. All rights reserved.
+//
+//    This file is part of puppy.
+//
+//    puppy is free software: you can redistribute it and/or modify
+//    it under the terms of the GNU Affero General Public License as
+//    published by the Free Software Foundation, either version 3 of
+//    the License, or (at your option) any later version.
+//
+//    puppy is distributed in the hope that it will be useful,
+//    but WITHOUT ANY WARRANTY; without even the implied warranty of
+//    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//    GNU Affero General Public License for more details.
+//
+//    You should have received a copy of the GNU Affero General Public
+//    License along with puppy.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"math"
+	"sort"
+	"time"
+)
+
+// General note:
+// snapshot counts swing a lot at short periods. Request rates are
+// smoothed with exponentially weighted moving averages per snapshot, a la
+// unix load average, over 1, 5 and 15 minutes. As with load average the
+// rates start at 0, so take a while to settle after startup.
+//
+// The trend of a rate is the 1m average relative to the 5m average, i.e.
+// whether the recent snapshots are above or below the longer run.
+//
+// Besides the site rates, rates are kept for the keys of every dimension
+// (c.f. keyRates), i.e. for any key the tables show, bounded by the cap of
+// the dimension's table (c.f. tableCap).
+
+const ewmaCount = 3
+
+var ewmaWindows = [ewmaCount]time.Duration{time.Minute, 5 * time.Minute, 15 * time.Minute}
+
+// rates (req/s) per ewmaWindows
+type ewmaRates [ewmaCount]float64
+
+// adds the count of a snapshot period
+func (p *ewmaRates) update(cnt uint, period time.Duration) {
+	if period <= 0 {
+		return
+	}
+	instant := float64(cnt) / period.Seconds()
+	for i, window := range ewmaWindows {
+		alpha := 1 - math.Exp(-period.Seconds()/window.Seconds())
+		p[i] += alpha * (instant - p[i])
+	}
+}
+
+type trend byte
+
+const (
+	trendFlat trend = iota
+	trendUp
+	trendDown
+)
+
+func (t trend) String() string {
+	switch t {
+	case trendUp:
+		return "↑"
+	case trendDown:
+		return "↓"
+	}
+	return "→"
+}
+
+// the 1m rate within ±10% of the 5m rate is flat
+const trendTolerance = 0.1
+
+func (p ewmaRates) trend() trend {
+	switch delta := p[0] - p[1]; {
+	case delta > trendTolerance*p[1]:
+		return trendUp
+	case delta < -trendTolerance*p[1]:
+		return trendDown
+	}
+	return trendFlat
+}
+
+// ----------------------------------------------------------------------
+// rates by key
+
+// the keys of each snapshot are tracked, until their 15m rate decays below
+// the floor, or they are evicted (slowest 1m rate first) to keep the
+// tracked keys to the cap of the table.
+const ewmaFloor = 1e-4
+
+// the rates of the keys of a dimension
+type keyRates map[string]*ewmaRates
+
+// updates the rates of the tracked keys per the snapshot stats, with keys
+// not in the snapshot counting 0, and returns the (copied) rates by key.
+// max is the cap of the dimension's table, i.e. of the keys of a snapshot
+// (0 if unbounded).
+func (p keyRates) update(stats *accessStats, period time.Duration, max int) map[string]ewmaRates {
+	counts := make(map[string]uint, len(stats.inOrder))
+	for _, item := range stats.inOrder {
+		if item.name == otherKey { /* not a key, c.f. cappedTable */
+			continue
+		}
+		if _, ok := p[item.name]; !ok {
+			p[item.name] = &ewmaRates{}
+		}
+		counts[item.name] = item.counter.total
+	}
+	var evictable []string
+	for key, r := range p {
+		_, current := counts[key]
+		r.update(counts[key], period)
+		switch {
+		case r[ewmaCount-1] < ewmaFloor:
+			delete(p, key)
+		case !current:
+			evictable = append(evictable, key)
+		}
+	}
+	if excess := len(p) - max; max > 0 && excess > 0 {
+		sort.Slice(evictable, func(i, j int) bool { return p[evictable[i]][0] < p[evictable[j]][0] })
+		if excess > len(evictable) { /* the keys of the snapshot are kept */
+			excess = len(evictable)
+		}
+		for _, key := range evictable[:excess] {
+			delete(p, key)
+		}
+	}
+	rates := make(map[string]ewmaRates, len(p))
+	for key, r := range p {
+		rates[key] = *r
+	}
+	return rates
+}
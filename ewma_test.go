@@ -0,0 +1,101 @@
+//    Copyright © 2016 Joubin Houshyar. All rights reserved.
+//
+//    This file is part of puppy.
+//
+//    puppy is free software: you can redistribute it and/or modify
+//    it under the terms of the GNU Affero General Public License as
+//    published by the Free Software Foundation, either version 3 of
+//    the License, or (at your option) any later version.
+//
+//    puppy is distributed in the hope that it will be useful,
+//    but WITHOUT ANY WARRANTY; without even the implied warranty of
+//    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//    GNU Affero General Public License for more details.
+//
+//    You should have received a copy of the GNU Affero General Public
+//    License along with puppy.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+// the keys of snapshots of 100 new keys, of ascending counts
+func keyRatesSnapshot(snapshot int) *accessStats {
+	stats := &accessStats{}
+	for i := 0; i < 100; i++ {
+		name := fmt.Sprintf("/%d/%d", snapshot, i)
+		stats.inOrder = append(stats.inOrder, namedCounter{name: name, counter: &accessCounter{total: uint(i + 1)}})
+	}
+	stats.inOrder = append(stats.inOrder, namedCounter{name: otherKey, counter: &accessCounter{total: 1000}})
+	return stats
+}
+
+func TestKeyRatesBounded(t *testing.T) {
+	const max = 150
+	p := make(keyRates)
+	for snapshot := 0; snapshot < 20; snapshot++ {
+		rates := p.update(keyRatesSnapshot(snapshot), time.Second, max)
+		if len(p) > max || len(rates) != len(p) {
+			t.Fatalf("snapshot %d - tracking %d keys (%d rates), max %d", snapshot, len(p), len(rates), max)
+		}
+		if _, ok := rates[otherKey]; ok {
+			t.Fatalf("snapshot %d - %s is tracked", snapshot, otherKey)
+		}
+		for i := 0; i < 100; i++ { /* every key of the snapshot is tracked */
+			if _, ok := rates[fmt.Sprintf("/%d/%d", snapshot, i)]; !ok {
+				t.Fatalf("snapshot %d - key %d not tracked", snapshot, i)
+			}
+		}
+		if snapshot == 0 {
+			continue
+		}
+		/* the slowest prior keys are evicted first */
+		if _, ok := rates[fmt.Sprintf("/%d/99", snapshot-1)]; !ok {
+			t.Fatalf("snapshot %d - fastest prior key evicted", snapshot)
+		}
+		if _, ok := rates[fmt.Sprintf("/%d/0", snapshot-1)]; ok {
+			t.Fatalf("snapshot %d - slowest prior key tracked", snapshot)
+		}
+	}
+}
+
+// keys of unbounded tables are tracked until their rates decay
+func TestKeyRatesUnbounded(t *testing.T) {
+	p := make(keyRates)
+	for snapshot := 0; snapshot < 20; snapshot++ {
+		p.update(keyRatesSnapshot(snapshot), time.Second, 0)
+	}
+	if len(p) != 20*100 {
+		t.Errorf("tracking %d keys, expected %d", len(p), 20*100)
+	}
+	for i := 0; i < 10; i++ { /* empty snapshots of an hour each */
+		p.update(&accessStats{}, time.Hour, 0)
+	}
+	if len(p) != 0 {
+		t.Errorf("tracking %d decayed keys", len(p))
+	}
+}
+
+func TestTableCap(t *testing.T) {
+	saved := conf
+	t.Cleanup(func() { conf = saved })
+	tests := []struct {
+		topK, maxKeys   uint
+		bounded, capped int // tableCap of bounded and other tables
+	}{
+		{0, 0, 0, 0},
+		{100, 0, 100, 0},
+		{0, 500, 500, 500},
+		{100, 500, 100, 500},
+	}
+	for _, test := range tests {
+		conf.topK, conf.maxKeys = test.topK, test.maxKeys
+		if bounded, capped := tableCap(true), tableCap(false); bounded != test.bounded || capped != test.capped {
+			t.Errorf("topk %d, max keys %d - caps %d and %d", test.topK, test.maxKeys, bounded, capped)
+		}
+	}
+}
@@ -0,0 +1,180 @@
+//    Copyright © 2016 Joubin Houshyar. All rights reserved.
+//
+//    This file is part of puppy.
+//
+//    puppy is free software: you can redistribute it and/or modify
+//    it under the terms of the GNU Affero General Public License as
+//    published by the Free Software Foundation, either version 3 of
+//    the License, or (at your option) any later version.
+//
+//    puppy is distributed in the hope that it will be useful,
+//    but WITHOUT ANY WARRANTY; without even the implied warranty of
+//    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//    GNU Affero General Public License for more details.
+//
+//    You should have received a copy of the GNU Affero General Public
+//    License along with puppy.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"fmt"
+	"math"
+	"math/bits"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// General note:
+// CLF has no latency field, but nginx ($request_time) and Apache (%D, %T)
+// formats can add one as a trailing field (c.f. conf.durationField). The
+// latency distribution is captured in an HDR style histogram, which is
+// mergeable (so per resource histograms can be summed to the snapshot's)
+// and has bounded relative error, at the cost of a (sparse) bucket map.
+
+// ----------------------------------------------------------------------
+// duration field
+
+// units of the duration field, e.g. nginx $request_time is in (fractional)
+// seconds, and Apache %D in microseconds.
+var durationUnits = map[string]time.Duration{
+	"s":  time.Second,
+	"ms": time.Millisecond,
+	"us": time.Microsecond,
+}
+
+// parses a duration field per the unit. '-' (or "") indicates no value,
+// in which case ok is false.
+func parseDuration(s string, unit time.Duration) (d time.Duration, ok bool, e error) {
+	if s == "" || s == "-" {
+		return 0, false, nil
+	}
+	v, e := strconv.ParseFloat(s, 64)
+	if e != nil {
+		return 0, false, e
+	}
+	if v < 0 || math.IsNaN(v) || math.IsInf(v, 0) {
+		return 0, false, fmt.Errorf("invalid duration %q", s)
+	}
+	return time.Duration(v * float64(unit)), true, nil
+}
+
+// ----------------------------------------------------------------------
+// histogram
+
+// values are recorded in microseconds. Each power of 2 range of values is
+// split into 2^histSubBits linear buckets, bounding the relative error of
+// reported quantiles to 2^-histSubBits (i.e. < 1%).
+const histSubBits = 7
+
+type histogram struct {
+	buckets map[uint32]uint64
+	n       uint64
+	max     time.Duration
+}
+
+func newHistogram() *histogram {
+	return &histogram{buckets: make(map[uint32]uint64)}
+}
+
+func histBucket(v uint64) uint32 {
+	if v < 1<<histSubBits {
+		return uint32(v)
+	}
+	shift := uint(bits.Len64(v)-1) - histSubBits
+	m := v >> shift
+	return uint32((shift+1)<<histSubBits) + uint32(m-1<<histSubBits)
+}
+
+// returns the mid-point value of the bucket
+func histValue(b uint32) uint64 {
+	if b < 1<<histSubBits {
+		return uint64(b)
+	}
+	shift := uint(b>>histSubBits) - 1
+	m := uint64(b&(1<<histSubBits-1)) + 1<<histSubBits
+	return m<<shift + (1<<shift)/2
+}
+
+func (p *histogram) record(d time.Duration) {
+	p.buckets[histBucket(uint64(d/time.Microsecond))]++
+	p.n++
+	if d > p.max {
+		p.max = d
+	}
+}
+
+// adds all recordings of other to the receiver
+func (p *histogram) merge(other *histogram) {
+	if other == nil {
+		return
+	}
+	for b, cnt := range other.buckets {
+		p.buckets[b] += cnt
+	}
+	p.n += other.n
+	if other.max > p.max {
+		p.max = other.max
+	}
+}
+
+// returns the recordings of the receiver that aren't of other, which is
+// a subset of them (e.g. c.f. accessCounter.view), or nil if none. The
+// max is that of the receiver.
+func (p *histogram) without(other *histogram) *histogram {
+	if p == nil || other == nil {
+		return p
+	}
+	diff := newHistogram()
+	for b, cnt := range p.buckets {
+		if cnt -= other.buckets[b]; cnt > 0 {
+			diff.buckets[b] = cnt
+		}
+	}
+	diff.n = p.n - other.n
+	if diff.n == 0 {
+		return nil
+	}
+	diff.max = p.max
+	return diff
+}
+
+// returns the q-th (0 < q <= 1) quantile, or 0 if empty.
+func (p *histogram) quantile(q float64) time.Duration {
+	if p.n == 0 {
+		return 0
+	}
+	keys := make([]uint32, 0, len(p.buckets))
+	for b := range p.buckets {
+		keys = append(keys, b)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+
+	rank := uint64(math.Ceil(q * float64(p.n)))
+	cnt := uint64(0)
+	for _, b := range keys {
+		cnt += p.buckets[b]
+		if cnt >= rank {
+			d := time.Duration(histValue(b)) * time.Microsecond
+			if d > p.max {
+				d = p.max
+			}
+			return d
+		}
+	}
+	return p.max
+}
+
+// quantiles reported in views
+type latencySummary struct {
+	p50, p90, p99, max time.Duration
+}
+
+// returns nil if there are no recordings.
+func (p *histogram) summary() *latencySummary {
+	if p == nil || p.n == 0 {
+		return nil
+	}
+	return &latencySummary{p.quantile(.5), p.quantile(.9), p.quantile(.99), p.max}
+}
@@ -0,0 +1,140 @@
+// friend
+
+//    Copyright © 2016 Joubin Houshyar. All rights reserved.
+//
+//    This file is part of puppy.
+//
+//    puppy is free software: you can redistribute it and/or modify
+//    it under the terms of the GNU Affero General Public License as
+//    published by the Free Software Foundation, either version 3 of
+//    the License, or (at your option) any later version.
+//
+//    puppy is distributed in the hope that it will be useful,
+//    but WITHOUT ANY WARRANTY; without even the implied warranty of
+//    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//    GNU Affero General Public License for more details.
+//
+//    You should have received a copy of the GNU Affero General Public
+//    License along with puppy.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+	"testing"
+	"time"
+)
+
+// values round-trip through their bucket within the relative error
+func TestHistBucketRoundTrip(t *testing.T) {
+	maxErr := math.Pow(2, -histSubBits)
+	values := []uint64{0, 1, 127, 128, 129, 255, 256, 1000, 1 << 20, 123456789, 1 << 40}
+	for i := 0; i < 1000; i++ {
+		values = append(values, uint64(rand.Int63n(1<<36)))
+	}
+	for _, v := range values {
+		b := histBucket(v)
+		rt := histValue(b)
+		if v < 1<<histSubBits {
+			if rt != v {
+				t.Errorf("%d - exact below %d, got %d", v, 1<<histSubBits, rt)
+			}
+			continue
+		}
+		if e := math.Abs(float64(rt)-float64(v)) / float64(v); e > maxErr {
+			t.Errorf("%d - bucket %d value %d, relative error %g", v, b, rt, e)
+		}
+		if next := histBucket(v + 1); next < b {
+			t.Errorf("%d - buckets not monotonic, %d then %d", v, b, next)
+		}
+	}
+}
+
+func TestHistogramQuantiles(t *testing.T) {
+	uniform := make([]time.Duration, 0, 10000)
+	for ms := 1; ms <= 10000; ms++ {
+		uniform = append(uniform, time.Duration(ms)*time.Millisecond)
+	}
+	exponential := make([]time.Duration, 0, 100000)
+	rnd := rand.New(rand.NewSource(1))
+	for i := 0; i < 100000; i++ {
+		exponential = append(exponential, time.Duration(rnd.ExpFloat64()*float64(50*time.Millisecond)))
+	}
+	for name, values := range map[string][]time.Duration{"uniform": uniform, "exponential": exponential} {
+		hist := newHistogram()
+		for _, d := range values {
+			hist.record(d)
+		}
+		sorted := append([]time.Duration(nil), values...)
+		sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+		for _, q := range []float64{.5, .9, .99, 1} {
+			expected := sorted[int(math.Ceil(q*float64(len(sorted))))-1]
+			got := hist.quantile(q)
+			if e := math.Abs(float64(got-expected)) / float64(expected); e > 0.01 {
+				t.Errorf("%s - q%g %s, expected %s", name, q, got, expected)
+			}
+		}
+		if hist.max != sorted[len(sorted)-1] || hist.summary().max != hist.max {
+			t.Errorf("%s - max %s, expected %s", name, hist.max, sorted[len(sorted)-1])
+		}
+	}
+}
+
+func TestHistogramEmpty(t *testing.T) {
+	hist := newHistogram()
+	if q := hist.quantile(.5); q != 0 {
+		t.Errorf("expected 0, got %s", q)
+	}
+	if hist.summary() != nil || (*histogram)(nil).summary() != nil {
+		t.Errorf("expected no summary")
+	}
+}
+
+func TestHistogramMerge(t *testing.T) {
+	a, b, all := newHistogram(), newHistogram(), newHistogram()
+	for ms := 1; ms <= 1000; ms++ {
+		d := time.Duration(ms) * time.Millisecond
+		if ms%3 == 0 {
+			a.record(d)
+		} else {
+			b.record(d)
+		}
+		all.record(d)
+	}
+	a.merge(b)
+	a.merge(nil)
+	if a.n != all.n || a.max != all.max {
+		t.Fatalf("merged n %d max %s, expected %d %s", a.n, a.max, all.n, all.max)
+	}
+	for _, q := range []float64{.5, .9, .99} {
+		if a.quantile(q) != all.quantile(q) {
+			t.Errorf("q%g - merged %s, expected %s", q, a.quantile(q), all.quantile(q))
+		}
+	}
+}
+
+func TestParseDuration(t *testing.T) {
+	tests := []struct {
+		s    string
+		unit time.Duration
+		d    time.Duration
+		ok   bool
+		err  bool
+	}{
+		{"0.250", time.Second, 250 * time.Millisecond, true, false},
+		{"1234", time.Microsecond, 1234 * time.Microsecond, true, false},
+		{"-", time.Second, 0, false, false},
+		{"", time.Second, 0, false, false},
+		{"-1", time.Second, 0, false, true},
+		{"NaN", time.Second, 0, false, true},
+		{"fast", time.Second, 0, false, true},
+	}
+	for _, test := range tests {
+		d, ok, e := parseDuration(test.s, test.unit)
+		if d != test.d || ok != test.ok || (e != nil) != test.err {
+			t.Errorf("%q - got %s %t %v", test.s, d, ok, e)
+		}
+	}
+}
@@ -0,0 +1,192 @@
+//    Copyright © 2016 Joubin Houshyar. All rights reserved.
+//
+//    This file is part of puppy.
+//
+//    puppy is free software: you can redistribute it and/or modify
+//    it under the terms of the GNU Affero General Public License as
+//    published by the Free Software Foundation, either version 3 of
+//    the License, or (at your option) any later version.
+//
+//    puppy is distributed in the hope that it will be useful,
+//    but WITHOUT ANY WARRANTY; without even the implied warranty of
+//    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//    GNU Affero General Public License for more details.
+//
+//    You should have received a copy of the GNU Affero General Public
+//    License along with puppy.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+// General note:
+// When traffic jumps, the question is which keys drove the change. Movers
+// compare the request counts of the keys of the snapshot with those of a
+// reference, either the prior snapshot, or the average snapshot of the
+// last few minutes (c.f. conf.moversWindowMin), ordered by impact, i.e.
+// the absolute change in requests. Keys new to, or gone from, the
+// snapshot are flagged. Movers are of the (scoped) snapshot and the
+// history is restarted on scope change.
+
+// the attributes of which movers are reported
+var moversAttributes = []string{"resource", "host", "user"}
+
+// the reference movers are compared with
+type moversReference int
+
+const (
+	priorSnapshot moversReference = iota
+	windowAverage
+	moversReferences // not a reference
+)
+
+func (p moversReference) String() string {
+	switch p {
+	case priorSnapshot:
+		return "prior snapshot"
+	case windowAverage:
+		return "window average"
+	}
+	return fmt.Sprintf("moversReference(%d)", int(p))
+}
+
+type mover struct {
+	name    string
+	current uint
+	prior   float64 // average per snapshot if windowed
+}
+
+func (p mover) delta() float64 { return float64(p.current) - p.prior }
+func (p mover) isNew() bool    { return p.prior == 0 }
+func (p mover) isGone() bool   { return p.current == 0 }
+
+// relative change, or 0 if new
+func (p mover) change() float64 {
+	if p.prior == 0 {
+		return 0
+	}
+	return p.delta() / p.prior
+}
+
+// request counts of a snapshot, by attribute and key
+type moverCounts map[string]map[string]uint
+
+// bounds the keys of a snapshot (its top keys), and of the window sums,
+// per attribute
+const moversMaxKeys = 500
+
+// compares the counts with the average of the reference counts, i.e. the
+// sums of n snapshots. Returns nil if there are no reference counts.
+func compareCounts(current, sums map[string]uint, n uint) []mover {
+	if n == 0 {
+		return nil
+	}
+	items := make([]mover, 0, len(sums)+len(current))
+	for key, cnt := range current {
+		items = append(items, mover{key, cnt, float64(sums[key]) / float64(n)})
+	}
+	for key, sum := range sums {
+		if _, ok := current[key]; !ok {
+			items = append(items, mover{key, 0, float64(sum) / float64(n)})
+		}
+	}
+	sort.Slice(items, func(i, j int) bool {
+		di, dj := math.Abs(items[i].delta()), math.Abs(items[j].delta())
+		if di != dj {
+			return di > dj
+		}
+		return items[i].name < items[j].name
+	})
+	return items
+}
+
+// the counts of the snapshots of the movers window, and their running
+// sums so the window average isn't summed anew every snapshot. Once the
+// sums of an attribute hold moversMaxKeys keys, new keys aren't summed
+// until others drop out of the window, so the ring keeps the counts that
+// were summed (the window average of the keys that weren't is thus 0).
+type moversHistory struct {
+	snapshots *ringBuffer // <moverCounts> : summed counts
+	n         uint        // snapshots in the ring
+	sums      moverCounts
+	prior     moverCounts // nil if none
+}
+
+func newMoversHistory(windowMin uint) *moversHistory {
+	n := windowMin * 60 / conf.statPeriodSec
+	if n == 0 {
+		n = 1
+	}
+	sums := make(moverCounts, len(moversAttributes))
+	for _, attribute := range moversAttributes {
+		sums[attribute] = make(map[string]uint)
+	}
+	return &moversHistory{snapshots: newRingBuffer(n), sums: sums}
+}
+
+// returns the top keys of the snapshot stats by attribute
+func snapshotCounts(byDimension map[string]*accessStats) moverCounts {
+	current := make(moverCounts, len(moversAttributes))
+	for _, attribute := range moversAttributes {
+		counts := make(map[string]uint)
+		if data := byDimension[attribute]; data != nil {
+			for _, item := range topEntries(data.inOrder, moversMaxKeys) {
+				counts[item.name] = item.counter.total
+			}
+		}
+		current[attribute] = counts
+	}
+	return current
+}
+
+// adds the counts to the sums, evicting the oldest snapshot if the ring
+// is full
+func (p *moversHistory) add(current moverCounts) {
+	if evicted := p.snapshots.next(); evicted != nil {
+		for attribute, counts := range evicted.(moverCounts) {
+			sums := p.sums[attribute]
+			for key, cnt := range counts {
+				if sums[key] -= cnt; sums[key] == 0 {
+					delete(sums, key)
+				}
+			}
+		}
+		p.n--
+	}
+	summed := make(moverCounts, len(current))
+	for attribute, counts := range current {
+		sums := p.sums[attribute]
+		summed[attribute] = make(map[string]uint, len(counts))
+		for key, cnt := range counts {
+			if _, ok := sums[key]; ok || len(sums) < moversMaxKeys {
+				sums[key] += cnt
+				summed[attribute][key] = cnt
+			}
+		}
+	}
+	p.snapshots.add(summed)
+	p.n++
+}
+
+// returns the movers of the snapshot stats by reference and attribute, and
+// adds the snapshot to the history.
+func (p *moversHistory) update(byDimension map[string]*accessStats) [moversReferences]map[string][]mover {
+	current := snapshotCounts(byDimension)
+	var movers [moversReferences]map[string][]mover
+	for ref := range movers {
+		movers[ref] = make(map[string][]mover, len(moversAttributes))
+	}
+	for _, attribute := range moversAttributes {
+		if p.prior != nil {
+			movers[priorSnapshot][attribute] = compareCounts(current[attribute], p.prior[attribute], 1)
+		}
+		movers[windowAverage][attribute] = compareCounts(current[attribute], p.sums[attribute], p.n)
+	}
+	p.add(current)
+	p.prior = current
+	return movers
+}
@@ -0,0 +1,99 @@
+//    Copyright © 2016 Joubin Houshyar. All rights reserved.
+//
+//    This file is part of puppy.
+//
+//    puppy is free software: you can redistribute it and/or modify
+//    it under the terms of the GNU Affero General Public License as
+//    published by the Free Software Foundation, either version 3 of
+//    the License, or (at your option) any later version.
+//
+//    puppy is distributed in the hope that it will be useful,
+//    but WITHOUT ANY WARRANTY; without even the implied warranty of
+//    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//    GNU Affero General Public License for more details.
+//
+//    You should have received a copy of the GNU Affero General Public
+//    License along with puppy.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+func moverStats(counts map[string]uint) map[string]*accessStats {
+	table := newExactTable()
+	for key, cnt := range counts {
+		table.counter(key).total = cnt
+	}
+	return map[string]*accessStats{"resource": newAccessStats(table)}
+}
+
+// the running sums match the sums of the snapshots in the window, as
+// snapshots are evicted
+func TestMoversRunningSums(t *testing.T) {
+	defer func(s uint) { conf.statPeriodSec = s }(conf.statPeriodSec)
+	conf.statPeriodSec = 60
+	history := newMoversHistory(3)
+	snapshots := []map[string]uint{
+		{"/a": 10, "/b": 5},
+		{"/a": 20, otherKey: 100},
+		{"/b": 7, "/c": 1},
+		{"/a": 30},
+		{"/c": 2},
+	}
+	// sums of the snapshots [from, to), but otherKey
+	sum := func(from, to int) map[string]uint {
+		if from < 0 {
+			from = 0
+		}
+		sums := make(map[string]uint)
+		for _, counts := range snapshots[from:to] {
+			for key, cnt := range counts {
+				if key != otherKey {
+					sums[key] += cnt
+				}
+			}
+		}
+		return sums
+	}
+	for i, counts := range snapshots {
+		movers := history.update(moverStats(counts))
+		if got, expected := history.sums["resource"], sum(i-2, i+1); fmt.Sprint(got) != fmt.Sprint(expected) {
+			t.Errorf("snapshot %d - sums %v, expected %v", i, got, expected)
+		}
+		if i == 0 {
+			if movers[windowAverage]["resource"] != nil || movers[priorSnapshot]["resource"] != nil {
+				t.Errorf("expected no movers without history")
+			}
+			continue
+		}
+		reference, n := sum(i-3, i), float64(i)
+		if i > 3 {
+			n = 3
+		}
+		for _, mover := range movers[windowAverage]["resource"] {
+			if mover.name == otherKey {
+				t.Errorf("snapshot %d - otherKey is a mover", i)
+			}
+			if mover.prior != float64(reference[mover.name])/n || mover.current != counts[mover.name] {
+				t.Errorf("snapshot %d - %+v, expected prior %v", i, mover, float64(reference[mover.name])/n)
+			}
+		}
+	}
+}
+
+func TestMoversCap(t *testing.T) {
+	history := newMoversHistory(1)
+	for s := 0; s < 3; s++ {
+		counts := make(map[string]uint)
+		for i := 0; i < moversMaxKeys; i++ {
+			counts[fmt.Sprintf("/%d/%d", s, i)] = uint(i + 1)
+		}
+		history.update(moverStats(counts))
+		if n := len(history.sums["resource"]); n > moversMaxKeys {
+			t.Fatalf("snapshot %d - %d keys summed", s, n)
+		}
+	}
+}
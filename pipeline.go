@@ -0,0 +1,367 @@
+//    Copyright © 2016 Joubin Houshyar. All rights reserved.
+//
+//    This file is part of puppy.
+//
+//    puppy is free software: you can redistribute it and/or modify
+//    it under the terms of the GNU Affero General Public License as
+//    published by the Free Software Foundation, either version 3 of
+//    the License, or (at your option) any later version.
+//
+//    puppy is distributed in the hope that it will be useful,
+//    but WITHOUT ANY WARRANTY; without even the implied warranty of
+//    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//    GNU Affero General Public License for more details.
+//
+//    You should have received a copy of the GNU Affero General Public
+//    License along with puppy.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// General note:
+// Per the REVU note of metrics.takeSnapshot, parsing and measures.Update
+// are the bulk of the per line cost, and are spread across n shards (c.f.
+// conf.workers), each a goroutine owning its wip measures, so there is no
+// locking on the hot path. Lines are sharded by the hash of a key field
+// (c.f. conf.shardBy), by default the remote host, i.e. the client unless
+// behind a proxy, in which case the user or the whole line spread the
+// load better. Lines are dispatched in batches to amortize channel
+// hand-offs.
+//
+// Whether this pays off is yet to be measured: the only benchmarks run
+// (c.f. BenchmarkIngest*) were on a single CPU, where the pipeline is
+// slower than inline ingestion (some 125k to 160k lines/s vs 130k to
+// 170k lines/s), as it only adds the dispatch and the merges. Hence the
+// pipeline is off by default (-workers 1). Compare on multi-CPU hosts with
+// e.g. go test -bench Ingest -benchtime 100000x -cpu 1,2,4
+//
+// At snapshot time, each shard hands off its wip (and starts anew) in
+// order with the lines it was sent, which is the serialization point.
+// The hand-offs are then merged by a goroutine of their own (c.f. swap),
+// so the shards carry on ingesting, and the main routine on dispatching
+// lines, until the merged hand-off is received (c.f. pipeline.merged).
+//
+// Besides the measures, the shards keep the SLO tallies, totals and the
+// visitor sessions of their lines, which are merged at snapshot time as
+// well. Sessions are thus only exact if the lines of a visitor land on
+// the same shard, as with -shard-by host (bar users roaming across
+// hosts). Parsed entries are returned (in batches) to the main routine,
+// which only keeps the journals and the recent accesses (c.f. pivot).
+// Lines of different shards may thus be journaled out of order.
+//
+// Totals are running counts, so rather than adding up the shards' counts
+// of each snapshot, and with these the error bounds of top-k tables (c.f.
+// topKTable.merge), the shards keep running totals (since start or reset)
+// and hand off copies, which are merged anew at each snapshot.
+//
+// Channel sends of the main routine also receive the shards' batches,
+// as shards may otherwise block on returning a batch while the main
+// routine blocks on sending them more lines.
+
+// lines per dispatched batch. Partial batches are flushed periodically,
+// so lines are measured within the period.
+const (
+	shardBatchSize      = 256
+	pipelineFlushPeriod = 50 * time.Millisecond
+)
+
+// the parsed entries of a batch of lines. Parsing stops at the first
+// error, so entries may be short of lines.
+type shardBatch struct {
+	lines   [][]byte
+	entries []*logEntry // nil for lines with no entry
+	e       error
+}
+
+// the per snapshot state of a shard, handed off (and merged) on swap
+type shardWip struct {
+	at             time.Time // of the swap
+	scope          string    // of scopedWip
+	wip, scopedWip *measures
+	slos           sloTallies
+	totals         *totals       // copy of the running totals
+	sessions       *sessionDelta // nil if not tracked
+}
+
+// adds the state of other
+func (p *shardWip) merge(other *shardWip) {
+	p.wip.merge(other.wip)
+	if p.scopedWip != nil && other.scopedWip != nil {
+		p.scopedWip.merge(other.scopedWip)
+	}
+	p.slos.merge(other.slos)
+	p.totals.merge(other.totals)
+	if p.sessions != nil {
+		p.sessions.merge(other.sessions)
+	}
+}
+
+type shardMsg struct {
+	lines [][]byte       // ingest
+	swap  chan *shardWip // snapshot hand-off
+	scope *string        // rescope (c.f. metrics.setScope)
+	reset *time.Time     // restart the totals (c.f. metrics.resetTotals)
+	stop  bool
+}
+
+type shard struct {
+	in       chan shardMsg
+	wip      *shardWip
+	scope    string
+	totals   *totals     // since start or reset
+	sessions *sessionSet // nil if not tracked
+}
+
+type pipeline struct {
+	shards   []*shard
+	keyField int              // c.f. shardKeyFields
+	pending  [][][]byte       // per shard batch
+	out      chan *shardBatch // parsed batches
+	received []*shardBatch    // received while sending, c.f. takeReceived
+	merged   chan *shardWip   // the merged hand-off of a swap
+	swapping bool             // until the merged hand-off is received
+	running  sync.WaitGroup
+}
+
+// the totals of the shards are since the given time (c.f. totals)
+func newPipeline(n uint, since time.Time) *pipeline {
+	p := &pipeline{
+		shards:   make([]*shard, n),
+		keyField: shardKeyFields[conf.shardBy],
+		pending:  make([][][]byte, n),
+		out:      make(chan *shardBatch, 4*n),
+		merged:   make(chan *shardWip, 1),
+	}
+	if p.keyField >= 0 && conf.vhostPrefix {
+		p.keyField++
+	}
+	for i := range p.shards {
+		s := &shard{in: make(chan shardMsg, 16), totals: newTotals(since)}
+		if conf.sessionTimeoutMin > 0 {
+			s.sessions = newSessionSet(time.Duration(conf.sessionTimeoutMin)*time.Minute, sessionsMaxActive/int(n))
+		}
+		s.wip = s.newWip()
+		p.shards[i] = s
+		p.running.Add(1)
+		go func() {
+			defer p.running.Done()
+			s.run(p.out)
+		}()
+	}
+	return p
+}
+
+func (s *shard) newWip() *shardWip {
+	w := &shardWip{scope: s.scope, wip: newMeasures(), slos: make(sloTallies)}
+	if s.scope != "" {
+		w.scopedWip = newMeasures()
+	}
+	return w
+}
+
+func (s *shard) run(out chan<- *shardBatch) {
+	for msg := range s.in {
+		switch {
+		case msg.swap != nil:
+			if s.sessions != nil {
+				s.wip.sessions = s.sessions.handoff(time.Now())
+			}
+			s.wip.totals = s.totals.clone()
+			msg.swap <- s.wip
+			s.wip = s.newWip()
+		case msg.scope != nil:
+			s.scope = *msg.scope
+			s.wip.scope, s.wip.scopedWip = s.scope, nil
+			if s.scope != "" {
+				s.wip.scopedWip = newMeasures()
+			}
+		case msg.reset != nil:
+			s.totals = newTotals(*msg.reset)
+		case msg.stop:
+			return
+		default:
+			out <- s.ingest(msg.lines)
+		}
+	}
+}
+
+func (s *shard) ingest(lines [][]byte) *shardBatch {
+	batch := &shardBatch{lines: lines, entries: make([]*logEntry, 0, len(lines))}
+	now := time.Now()
+	w := s.wip
+	for _, line := range lines {
+		entry, e := parseW3cCommonLogFormat(line)
+		if e != nil {
+			batch.e = fmt.Errorf("err - failed to parse tail out - %s\n", e.Error())
+			break
+		}
+		if entry != nil {
+			w.wip.Update(entry)
+			if w.scopedWip != nil && entry.vhost == s.scope {
+				w.scopedWip.Update(entry)
+			}
+			w.slos.Update(entry)
+			s.totals.Update(entry)
+			if s.sessions != nil {
+				s.sessions.Update(entry, now)
+			}
+		}
+		batch.entries = append(batch.entries, entry)
+	}
+	return batch
+}
+
+// the (0-based) line field hashed to pick the shard (c.f. conf.shardBy),
+// before any vhost prefix, or -1 for the whole line.
+var shardKeyFields = map[string]int{"host": 0, "user": 2, "line": -1}
+
+// the shard of the line, per the FNV-1a hash of its key field
+func (p *pipeline) shardOf(line []byte) int {
+	key := line
+	if p.keyField >= 0 {
+		key = lineField(line, p.keyField)
+	}
+	h := uint32(2166136261)
+	for _, b := range key {
+		h ^= uint32(b)
+		h *= 16777619
+	}
+	return int(h % uint32(len(p.shards)))
+}
+
+// returns the n-th (0-based) space or tab delimited field of the line,
+// or nil if there are fewer. The leading fields of log lines are never
+// quoted or bracketed with spaces (c.f. fieldScanner).
+func lineField(line []byte, n int) []byte {
+	for {
+		for len(line) > 0 && (line[0] == ' ' || line[0] == '\t') {
+			line = line[1:]
+		}
+		end := bytes.IndexAny(line, " \t")
+		if end < 0 {
+			end = len(line)
+		}
+		if n == 0 || end == len(line) {
+			if n > 0 {
+				return nil
+			}
+			return line[:end]
+		}
+		line, n = line[end:], n-1
+	}
+}
+
+// queues the line to its shard, sending the shard's batch once full
+func (p *pipeline) dispatch(line []byte) {
+	n := p.shardOf(line)
+	p.pending[n] = append(p.pending[n], line)
+	if len(p.pending[n]) == shardBatchSize {
+		p.send(n, shardMsg{lines: p.pending[n]})
+		p.pending[n] = nil
+	}
+}
+
+// sends the pending (partial) batches
+func (p *pipeline) flush() {
+	for n, lines := range p.pending {
+		if len(lines) > 0 {
+			p.send(n, shardMsg{lines: lines})
+			p.pending[n] = nil
+		}
+	}
+}
+
+// sends the msg to the shard, receiving batches meanwhile
+func (p *pipeline) send(n int, msg shardMsg) {
+	for {
+		select {
+		case p.shards[n].in <- msg:
+			return
+		case batch := <-p.out:
+			p.received = append(p.received, batch)
+		}
+	}
+}
+
+// returns (and clears) the batches received while sending
+func (p *pipeline) takeReceived() []*shardBatch {
+	received := p.received
+	p.received = nil
+	return received
+}
+
+// rescopes the shards (c.f. metrics.setScope)
+func (p *pipeline) setScope(vhost string) {
+	for n := range p.shards {
+		p.send(n, shardMsg{scope: &vhost})
+	}
+}
+
+// restarts the totals of the shards (c.f. metrics.resetTotals)
+func (p *pipeline) resetTotals(since time.Time) {
+	for n := range p.shards {
+		p.send(n, shardMsg{reset: &since})
+	}
+}
+
+// flushes the pending lines and has the shards hand off their wip, which
+// are merged by a goroutine of their own and sent on merged. The
+// scopedWip is nil if unscoped, and sessions nil if not tracked. Returns
+// false (with no hand-off) if the merged hand-off of the prior swap is yet
+// to be received (c.f. swapped).
+func (p *pipeline) swap() bool {
+	if p.swapping {
+		return false
+	}
+	p.flush()
+	at := time.Now()
+	handoff := make(chan *shardWip, len(p.shards))
+	for n := range p.shards {
+		p.send(n, shardMsg{swap: handoff})
+	}
+	p.swapping = true
+	p.running.Add(1)
+	go func() {
+		defer p.running.Done()
+		merged := <-handoff
+		for n := 1; n < len(p.shards); n++ {
+			merged.merge(<-handoff)
+		}
+		merged.at = at
+		p.merged <- merged
+	}()
+	return true
+}
+
+// to be called on receiving the merged hand-off of a swap, which it
+// returns
+func (p *pipeline) swapped(merged *shardWip) *shardWip {
+	p.swapping = false
+	return merged
+}
+
+// stops the shards (and the merge of a swap) and waits for them to
+// return. Pending lines and the batches parsed meanwhile are dropped.
+func (p *pipeline) stop() {
+	for n := range p.shards {
+		p.send(n, shardMsg{stop: true})
+	}
+	stopped := make(chan bool)
+	go func() {
+		p.running.Wait()
+		close(stopped)
+	}()
+	for {
+		select {
+		case <-stopped:
+			return
+		case <-p.out: /* lest shards block on returning a batch */
+		}
+	}
+}
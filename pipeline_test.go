@@ -0,0 +1,324 @@
+//    Copyright © 2016 Joubin Houshyar. All rights reserved.
+//
+//    This file is part of puppy.
+//
+//    puppy is free software: you can redistribute it and/or modify
+//    it under the terms of the GNU Affero General Public License as
+//    published by the Free Software Foundation, either version 3 of
+//    the License, or (at your option) any later version.
+//
+//    puppy is distributed in the hope that it will be useful,
+//    but WITHOUT ANY WARRANTY; without even the implied warranty of
+//    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//    GNU Affero General Public License for more details.
+//
+//    You should have received a copy of the GNU Affero General Public
+//    License along with puppy.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+// synthetic lines of n hosts, with users per host (so visitors don't
+// roam across shards), and a mix of routes, statuses and agents.
+func testLines(n int) [][]byte {
+	agents := []string{"Mozilla/5.0 (X11; Linux x86_64) Firefox/120.0", "curl/8.0", "Googlebot/2.1"}
+	lines := make([][]byte, n)
+	for i := range lines {
+		host := i % 97
+		user := "-"
+		if host%5 == 0 {
+			user = fmt.Sprintf("user%d", host)
+		}
+		status := []uint{200, 200, 200, 304, 404, 500}[i%6]
+		lines[i] = []byte(fmt.Sprintf(
+			"10.0.%d.%d - %s [10/Oct/2000:13:55:36 -0700] \"GET /api/items/%d/view?page=%d HTTP/1.1\" %d %d \"-\" \"%s\"",
+			host/256, host%256, user, i%31, i%7, status, 100+i%1000, agents[i%len(agents)]))
+	}
+	return lines
+}
+
+// sets up the config, dimensions and SLO objectives of the tests, which
+// are restored on cleanup
+func setupPipelineTest(t testing.TB) {
+	savedConf, savedObjectives := conf, objectives
+	t.Cleanup(func() { conf, objectives = savedConf, savedObjectives })
+	conf.sessionTimeoutMin = 30
+	testDimensions(t, "status-class,host+route")
+	testUaRules(t)
+	objectives, _ = loadSloObjectives("", sloObjective{apdexT: 500 * time.Millisecond, target: 0.99})
+}
+
+// the (inline) reference state of the lines
+func ingestInline(t testing.TB, lines [][]byte) *shardWip {
+	w := &shardWip{wip: newMeasures(), slos: make(sloTallies), totals: newTotals(time.Time{})}
+	sessions := newSessionSet(30*time.Minute, sessionsMaxActive)
+	now := time.Now()
+	for _, line := range lines {
+		entry, e := parseW3cCommonLogFormat(line)
+		if e != nil {
+			t.Fatal(e)
+		}
+		w.wip.Update(entry)
+		w.slos.Update(entry)
+		w.totals.Update(entry)
+		sessions.Update(entry, now)
+	}
+	w.sessions = sessions.handoff(now)
+	return w
+}
+
+func ingestPipeline(t testing.TB, lines [][]byte, workers uint) *shardWip {
+	p := newPipeline(workers, time.Time{})
+	defer p.stop()
+	for _, line := range lines {
+		p.dispatch(line)
+	}
+	if !p.swap() {
+		t.Fatal("expected a swap")
+	}
+	if p.swap() {
+		t.Fatal("expected no swap until the merged hand-off is received")
+	}
+	batches, entries := p.takeReceived(), 0
+	var w *shardWip
+	for {
+		for _, batch := range batches {
+			if batch.e != nil {
+				t.Fatal(batch.e)
+			}
+			entries += len(batch.entries)
+		}
+		if w != nil && entries == len(lines) {
+			break
+		}
+		select { /* the remaining parsed batches, and the merged hand-off */
+		case batch := <-p.out:
+			batches = []*shardBatch{batch}
+		case merged := <-p.merged:
+			w, batches = p.swapped(merged), nil
+		}
+	}
+	return w
+}
+
+// swaps, returning the merged hand-off. Parsed batches are dropped.
+func awaitSwap(t testing.TB, p *pipeline) *shardWip {
+	if !p.swap() {
+		t.Fatal("expected a swap")
+	}
+	for {
+		select {
+		case <-p.out:
+		case merged := <-p.merged:
+			return p.swapped(merged)
+		}
+	}
+}
+
+// the counts by key of a table, for comparison
+func tableCounts(table counterTable) map[string][2]uint64 {
+	counts := make(map[string][2]uint64)
+	for _, entry := range table.entries() {
+		counts[entry.name] = [2]uint64{uint64(entry.counter.total), entry.counter.bytes}
+	}
+	return counts
+}
+
+func TestPipelineMatchesInline(t *testing.T) {
+	setupPipelineTest(t)
+	lines := testLines(20000)
+	inline := ingestInline(t, lines)
+	sharded := ingestPipeline(t, lines, 4)
+
+	if a, b := inline.wip.summary, sharded.wip.summary; a.total != b.total || a.bytes != b.bytes ||
+		a.classes != b.classes || a.methods != b.methods || a.filtered(botsOnly) != b.filtered(botsOnly) || !reflect.DeepEqual(a.codes, b.codes) {
+		t.Errorf("summary - inline %+v, pipeline %+v", a, b)
+	}
+	if sharded.wip.summary.total != uint(len(lines)) {
+		t.Errorf("summary - %d accesses, expected %d", sharded.wip.summary.total, len(lines))
+	}
+	for _, dim := range dimensions {
+		a, b := tableCounts(inline.wip.tables[dim.name]), tableCounts(sharded.wip.tables[dim.name])
+		if !reflect.DeepEqual(a, b) {
+			t.Errorf("dimension %s - inline %d keys, pipeline %d keys", dim.name, len(a), len(b))
+		}
+	}
+	if a, b := inline.wip.uniques.estimates(), sharded.wip.uniques.estimates(); a != b {
+		t.Errorf("uniques - inline %v, pipeline %v", a, b)
+	}
+	if !reflect.DeepEqual(inline.slos, sharded.slos) {
+		t.Errorf("slo tallies differ")
+	}
+	for _, attribute := range totalsAttributes {
+		a, b := tableCounts(inline.totals.tables[attribute]), tableCounts(sharded.totals.tables[attribute])
+		if !reflect.DeepEqual(a, b) {
+			t.Errorf("totals %s - inline %d keys, pipeline %d keys", attribute, len(a), len(b))
+		}
+	}
+	if a, b := inline.sessions, sharded.sessions; a.active != b.active || a.started != b.started ||
+		!reflect.DeepEqual(a.tally.landings, b.tally.landings) {
+		t.Errorf("sessions - inline %d/%d, pipeline %d/%d", a.active, a.started, b.active, b.started)
+	}
+}
+
+// lines dispatched while the hand-offs are merged are in the next swap
+func TestPipelineSwapOrder(t *testing.T) {
+	setupPipelineTest(t)
+	p := newPipeline(4, time.Time{})
+	defer p.stop()
+	lines := testLines(3000)
+	for _, line := range lines[:1000] {
+		p.dispatch(line)
+	}
+	p.swap()
+	for _, line := range lines[1000:] {
+		p.dispatch(line)
+	}
+	var handoffs []uint
+	for len(handoffs) < 2 {
+		select {
+		case <-p.out:
+		case merged := <-p.merged:
+			if handoffs = append(handoffs, p.swapped(merged).wip.summary.total); len(handoffs) == 1 {
+				p.swap()
+			}
+		}
+	}
+	if handoffs[0] != 1000 || handoffs[1] != 2000 {
+		t.Errorf("hand-offs of %v accesses, expected [1000 2000]", handoffs)
+	}
+}
+
+// the totals are of the shards' running totals since start or reset, so
+// the error bounds of top-k tables don't add up over snapshots
+func TestPipelineTotals(t *testing.T) {
+	setupPipelineTest(t)
+	conf.topK = 10
+	since := time.Now()
+	p := newPipeline(4, since)
+	defer p.stop()
+	lines := testLines(2000)
+	for round := 1; round <= 5; round++ {
+		for _, line := range lines {
+			p.dispatch(line)
+		}
+		w := awaitSwap(t, p)
+		if w.totals.summary.total != uint(round*len(lines)) || !w.totals.since.Equal(since) {
+			t.Fatalf("round %d - %d accesses since %s", round, w.totals.summary.total, w.totals.since)
+		}
+		shardsErr := uint(0)
+		for _, s := range p.shards {
+			_, maxErr := s.totals.tables["host"].errorBound()
+			shardsErr += maxErr
+		}
+		table := w.totals.tables["host"].(*topKTable)
+		if _, maxErr := table.errorBound(); maxErr > shardsErr+table.minHeap[0].counter.total {
+			t.Errorf("round %d - bound %d, of shards %d", round, maxErr, shardsErr)
+		}
+	}
+	reset := since.Add(time.Minute)
+	p.resetTotals(reset)
+	for _, line := range lines[:100] {
+		p.dispatch(line)
+	}
+	if w := awaitSwap(t, p); w.totals.summary.total != 100 || !w.totals.since.Equal(reset) {
+		t.Errorf("reset - %d accesses since %s", w.totals.summary.total, w.totals.since)
+	}
+}
+
+// stop returns with batches (and a swap) not received, as on quit
+func TestPipelineStop(t *testing.T) {
+	setupPipelineTest(t)
+	p := newPipeline(4, time.Time{})
+	for _, line := range testLines(20000) {
+		p.dispatch(line)
+	}
+	p.swap()
+	stopped := make(chan bool)
+	go func() {
+		p.stop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(10 * time.Second):
+		t.Fatal("stop is blocked")
+	}
+}
+
+func TestShardKeyField(t *testing.T) {
+	defer func(c string, v bool) { conf.shardBy, conf.vhostPrefix = c, v }(conf.shardBy, conf.vhostPrefix)
+	line := []byte("www.example.com:443 10.0.0.1 - jane [10/Oct/2000:13:55:36 -0700] \"GET / HTTP/1.1\" 200 1")
+	tests := []struct {
+		shardBy     string
+		vhostPrefix bool
+		key         string
+	}{
+		{"host", false, "www.example.com:443"},
+		{"host", true, "10.0.0.1"},
+		{"user", true, "jane"},
+		{"line", true, string(line)},
+	}
+	for _, test := range tests {
+		conf.shardBy, conf.vhostPrefix = test.shardBy, test.vhostPrefix
+		p := newPipeline(1, time.Time{})
+		key := line
+		if p.keyField >= 0 {
+			key = lineField(line, p.keyField)
+		}
+		if string(key) != test.key {
+			t.Errorf("%s (vhost prefix %t) - key %q, expected %q", test.shardBy, test.vhostPrefix, key, test.key)
+		}
+		p.stop()
+	}
+	if field := lineField([]byte("a  b"), 5); field != nil {
+		t.Errorf("expected no field, got %q", field)
+	}
+}
+
+// the shards of the lines of a vhost are spread per the remote host
+func TestShardSpread(t *testing.T) {
+	defer func(v bool) { conf.vhostPrefix = v }(conf.vhostPrefix)
+	conf.vhostPrefix = true
+	p := newPipeline(4, time.Time{})
+	defer p.stop()
+	counts := make([]int, 4)
+	for i := 0; i < 1000; i++ {
+		counts[p.shardOf([]byte(fmt.Sprintf("www.example.com:443 10.0.%d.%d - - [...] \"GET / HTTP/1.1\" 200 1", i/256, i%256)))]++
+	}
+	sort.Ints(counts)
+	if counts[0] < 150 {
+		t.Errorf("uneven shards %v", counts)
+	}
+}
+
+// lines/s of inline ingestion vs the pipeline, c.f. the pipeline note
+func benchmarkIngest(b *testing.B, workers uint) {
+	setupPipelineTest(b)
+	lines := testLines(10000)
+	b.ResetTimer()
+	for n := 0; n < b.N; {
+		batch := lines
+		if b.N-n < len(batch) {
+			batch = batch[:b.N-n]
+		}
+		if workers > 1 {
+			ingestPipeline(b, batch, workers)
+		} else {
+			ingestInline(b, batch)
+		}
+		n += len(batch)
+	}
+	b.ReportMetric(float64(b.N)/b.Elapsed().Seconds(), "lines/s")
+}
+
+func BenchmarkIngestInline(b *testing.B)    { benchmarkIngest(b, 1) }
+func BenchmarkIngestPipeline2(b *testing.B) { benchmarkIngest(b, 2) }
+func BenchmarkIngestPipeline4(b *testing.B) { benchmarkIngest(b, 4) }
@@ -0,0 +1,87 @@
+//    Copyright © 2016 Joubin Houshyar. All rights reserved.
+//
+//    This file is part of puppy.
+//
+//    puppy is free software: you can redistribute it and/or modify
+//    it under the terms of the GNU Affero General Public License as
+//    published by the Free Software Foundation, either version 3 of
+//    the License, or (at your option) any later version.
+//
+//    puppy is distributed in the hope that it will be useful,
+//    but WITHOUT ANY WARRANTY; without even the implied warranty of
+//    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//    GNU Affero General Public License for more details.
+//
+//    You should have received a copy of the GNU Affero General Public
+//    License along with puppy.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// General note:
+// measures keep a table per dimension, which can't answer cross-dimension
+// questions such as which hosts are getting 5xx on /api. Keeping counts
+// of every combination of dimensions is prohibitive, so instead the most
+// recent accesses (c.f. conf.pivotWindow) are kept as is, and pivot
+// queries filter and group them on demand. Pivots thus cover the recent
+// window of accesses, and not the snapshot period.
+
+// selects the accesses with the key in the dimension, e.g. status-class=5xx
+type pivotFilter struct {
+	dimension *dimension
+	key       string
+}
+
+func (p pivotFilter) String() string { return p.dimension.name + "=" + displayKey(p.key) }
+
+func (p pivotFilter) match(access *logEntry) bool {
+	for _, key := range p.dimension.keys(access) {
+		if key == p.key {
+			return true
+		}
+	}
+	return false
+}
+
+// returns the filters as a path, e.g. resource=/api > status-class=5xx
+func pivotPath(filters []pivotFilter) string {
+	path := make([]string, len(filters))
+	for i, filter := range filters {
+		path[i] = filter.String()
+	}
+	return strings.Join(path, " > ")
+}
+
+// returns the stats of the accesses matching all filters by the named
+// dimension, and the summary counts of the matching accesses.
+func pivot(accesses []*logEntry, filters []pivotFilter, attribute string) (*accessStats, *accessCounter, error) {
+	dim := findDimension(attribute)
+	if dim == nil {
+		return nil, nil, fmt.Errorf("err - pivot - unknown dimension %s", attribute)
+	}
+	table := newExactTable()
+	summary := newSummaryCounter()
+next:
+	for _, access := range accesses {
+		for _, filter := range filters {
+			if !filter.match(access) {
+				continue next
+			}
+		}
+		summary.Update(access)
+		summary.recordLatency(access)
+		for _, key := range dim.keys(access) {
+			counter := table.update(key, access)
+			if dim.timed {
+				counter.recordLatency(access)
+			}
+		}
+	}
+	stats := newAccessStats(table)
+	stats.timed = dim.timed
+	return stats, summary, nil
+}
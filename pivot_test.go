@@ -0,0 +1,113 @@
+// friend
+
+//    Copyright © 2016 Joubin Houshyar. All rights reserved.
+//
+//    This file is part of puppy.
+//
+//    puppy is free software: you can redistribute it and/or modify
+//    it under the terms of the GNU Affero General Public License as
+//    published by the Free Software Foundation, either version 3 of
+//    the License, or (at your option) any later version.
+//
+//    puppy is distributed in the hope that it will be useful,
+//    but WITHOUT ANY WARRANTY; without even the implied warranty of
+//    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//    GNU Affero General Public License for more details.
+//
+//    You should have received a copy of the GNU Affero General Public
+//    License along with puppy.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+// the counts of the pivot stats by key
+func pivotCounts(stats *accessStats) map[string]uint {
+	counts := make(map[string]uint)
+	for _, item := range stats.inOrder {
+		counts[item.name] = item.counter.total
+	}
+	return counts
+}
+
+func TestPivot(t *testing.T) {
+	testUaRules(t)
+	testDimensions(t, "status-class,host+status")
+	dim := func(name string) *dimension { return findDimension(name) }
+
+	/* the first 2 accesses are out of the recent window */
+	recent := &metrics{recent: newRingBuffer(5)}
+	for _, access := range []struct {
+		host   string
+		status uint
+		vhost  string
+	}{
+		{"a", 200, "x"}, {"b", 500, "x"},
+		{"a", 200, "x"}, {"a", 503, "x"}, {"b", 503, "y"}, {"c", 404, "x"}, {"a", 500, "x"},
+	} {
+		entry := testAccess("GET", access.status, 10)
+		entry.remoteHost, entry.vhost = access.host, access.vhost
+		recent.recent.add(entry)
+	}
+	tests := []struct {
+		name      string
+		scope     string
+		filters   []pivotFilter
+		attribute string
+		counts    map[string]uint
+		path      string
+	}{
+		{"all", "", nil, "status", map[string]uint{"200": 1, "503": 2, "404": 1, "500": 1}, ""},
+		{"5xx", "", []pivotFilter{{dim("status-class"), "5xx"}}, "host", map[string]uint{"a": 2, "b": 1}, "status-class=5xx"},
+		{"5xx of a", "", []pivotFilter{{dim("status-class"), "5xx"}, {dim("host"), "a"}}, "status",
+			map[string]uint{"503": 1, "500": 1}, "status-class=5xx > host=a"},
+		{"composite", "", []pivotFilter{{dim("host+status"), "a\x1f503"}}, "status-class",
+			map[string]uint{"5xx": 1}, "host+status=a | 503"},
+		{"no match", "", []pivotFilter{{dim("host"), "d"}}, "status", map[string]uint{}, "host=d"},
+		{"scoped", "x", nil, "host", map[string]uint{"a": 3, "c": 1}, ""},
+	}
+	for _, test := range tests {
+		recent.scope = test.scope
+		stats, summary, e := recent.pivot(test.filters, test.attribute)
+		if e != nil {
+			t.Errorf("%s - %v", test.name, e)
+			continue
+		}
+		n := uint(0)
+		for _, count := range test.counts {
+			n += count
+		}
+		if counts := pivotCounts(stats); !reflect.DeepEqual(counts, test.counts) || stats.total != uint(len(test.counts)) {
+			t.Errorf("%s - counts %v, expected %v", test.name, counts, test.counts)
+		}
+		if summary.total != n {
+			t.Errorf("%s - summary total %d, expected %d", test.name, summary.total, n)
+		}
+		if path := pivotPath(test.filters); path != test.path {
+			t.Errorf("%s - path %q, expected %q", test.name, path, test.path)
+		}
+	}
+	if stats, _, _ := recent.pivot(nil, "route"); stats != nil {
+		t.Errorf("expected no stats of an unknown dimension")
+	}
+	if _, _, e := recent.pivot(nil, "route"); e == nil {
+		t.Errorf("unknown dimension - expected an error")
+	}
+}
+
+// with no recent accesses (or with recent accesses off) the stats are empty
+func TestPivotEmpty(t *testing.T) {
+	testDimensions(t, "")
+	for _, recent := range []*metrics{{recent: newRingBuffer(5)}, {}} {
+		stats, summary, e := recent.pivot([]pivotFilter{{findDimension("status"), "200"}}, "host")
+		if e != nil {
+			t.Fatal(e)
+		}
+		if stats.total != 0 || len(stats.inOrder) != 0 || summary.total != 0 {
+			t.Errorf("expected empty stats, got %d keys, %d accesses", stats.total, summary.total)
+		}
+	}
+}
@@ -21,6 +21,7 @@ import (
 	"flag"
 	"fmt"
 	"log"
+	"math"
 	"os"
 	"os/signal"
 	"syscall"
@@ -35,8 +36,53 @@ var conf = struct {
 	trafficLimitLow, trafficLimitHigh uint
 	statPeriodSec, alertPeriodMin     uint
 	logJournalSize, alertsJournalSize uint
+	byRoute, routeBuiltins            bool
+	routeTemplates                    string
+	sectionDepth                      uint
+	queryParams                       bool
+	queryValues                       string
+	uaRules                           string
+	durationField                     uint
+	durationUnit                      string
+	vhostPrefix                       bool
+	vhostField                        uint
+	clientIpField                     uint
+	trustedProxies                    string
+	topK                              uint
+	dims                              string
+	pivotWindow                       uint
+	sessionTimeoutMin                 uint
+	sloFile                           string
+	apdexT                            time.Duration
+	apdexMin, sloTarget               float64
+	sloWindowMin                      uint
+	selfDomains                       string
+	workers                           uint
+	maxKeys                           uint
+	anomalyZ                          float64
+	moversWindowMin                   uint
+	shardBy                           string
 }{
-	"", 100, 10000, 1, 5, 1024, 1024,
+	trafficLimitLow:   100,
+	trafficLimitHigh:  10000,
+	statPeriodSec:     1,
+	alertPeriodMin:    5,
+	logJournalSize:    1024,
+	alertsJournalSize: 1024,
+	routeBuiltins:     true,
+	sectionDepth:      4,
+	durationUnit:      "s",
+	trustedProxies:    defaultTrustedProxies,
+	pivotWindow:       10000,
+	apdexT:            500 * time.Millisecond,
+	apdexMin:          0.7,
+	sloTarget:         99.9,
+	sloWindowMin:      60,
+	workers:           1,
+	maxKeys:           10000,
+	anomalyZ:          4,
+	moversWindowMin:   5,
+	shardBy:           "host",
 }
 
 func init() {
@@ -45,6 +91,34 @@ func init() {
 	flag.UintVar(&conf.trafficLimitHigh, "tmax", conf.trafficLimitHigh, "traffic max threshold ")
 	flag.UintVar(&conf.statPeriodSec, "s", conf.statPeriodSec, "stat snapshot period (sec)")
 	flag.UintVar(&conf.alertPeriodMin, "a", conf.alertPeriodMin, "alerts check period (min)")
+	flag.BoolVar(&conf.byRoute, "by-route", conf.byRoute, "group resources by route template (default by section)")
+	flag.BoolVar(&conf.routeBuiltins, "route-builtins", conf.routeBuiltins, "collapse ids, uuids, and hashes in routes")
+	flag.StringVar(&conf.routeTemplates, "routes", conf.routeTemplates, "route templates file (implies -by-route)")
+	flag.UintVar(&conf.sectionDepth, "section-depth", conf.sectionDepth, "section tree depth (path segments)")
+	flag.BoolVar(&conf.queryParams, "query", conf.queryParams, "track query parameters per resource")
+	flag.StringVar(&conf.queryValues, "query-values", conf.queryValues, "comma separated params whose values are tracked (implies -query)")
+	flag.StringVar(&conf.uaRules, "ua-rules", conf.uaRules, "user-agent rules file (default embedded rules)")
+	flag.UintVar(&conf.durationField, "duration-field", conf.durationField, "n-th trailing field (after bytes, referer & user-agent) with request duration (0:none)")
+	flag.StringVar(&conf.durationUnit, "duration-unit", conf.durationUnit, "request duration unit in {s, ms, us}")
+	flag.BoolVar(&conf.vhostPrefix, "vhost-prefix", conf.vhostPrefix, "first field is the vhost (e.g. Apache %v:%p)")
+	flag.UintVar(&conf.vhostField, "vhost-field", conf.vhostField, "n-th trailing field with the vhost (e.g. nginx $host) (0:none)")
+	flag.UintVar(&conf.clientIpField, "client-ip-field", conf.clientIpField, "n-th trailing field with X-Forwarded-For or X-Real-IP (0:none)")
+	flag.StringVar(&conf.trustedProxies, "trusted-proxies", conf.trustedProxies, "comma separated trusted proxy CIDRs")
+	flag.UintVar(&conf.topK, "topk", conf.topK, "bound resources, hosts & users to top-k per snapshot (0:unbounded)")
+	flag.StringVar(&conf.dims, "dims", conf.dims, "comma separated additional dimensions, e.g. status-class,host+route")
+	flag.UintVar(&conf.pivotWindow, "pivot-window", conf.pivotWindow, "recent accesses kept for pivot queries (0:off)")
+	flag.UintVar(&conf.sessionTimeoutMin, "session-timeout", conf.sessionTimeoutMin, "track visitor sessions with this inactivity timeout (min), e.g. 30 (0:off)")
+	flag.StringVar(&conf.sloFile, "slo", conf.sloFile, "per route apdex & availability objectives file")
+	flag.DurationVar(&conf.apdexT, "apdex-t", conf.apdexT, "default apdex satisfied threshold T")
+	flag.Float64Var(&conf.apdexMin, "apdex-min", conf.apdexMin, "default apdex alert threshold (0:none)")
+	flag.Float64Var(&conf.sloTarget, "slo-target", conf.sloTarget, "default availability objective (%)")
+	flag.UintVar(&conf.sloWindowMin, "slo-window", conf.sloWindowMin, "SLO rolling window (min)")
+	flag.StringVar(&conf.selfDomains, "self-domains", conf.selfDomains, "comma separated domains of internal referers (besides the vhost)")
+	flag.UintVar(&conf.workers, "workers", conf.workers, "parse & measure in n sharded goroutines (0|1:inline)")
+	flag.StringVar(&conf.shardBy, "shard-by", conf.shardBy, "field hashed to shard lines across workers in {host, user, line}")
+	flag.UintVar(&conf.maxKeys, "max-keys", conf.maxKeys, "cap on keys per dimension, totals table and section node per snapshot, the rest counted as (other) (0:none)")
+	flag.Float64Var(&conf.anomalyZ, "anomaly-z", conf.anomalyZ, "alert on |z-score| vs seasonal baseline above this (0:off)")
+	flag.UintVar(&conf.moversWindowMin, "movers-window", conf.moversWindowMin, "window (min) averaged as the movers view reference")
 }
 
 // ----------------------------------------------------------------------
@@ -78,6 +152,10 @@ var accessMetrics *metrics
 // last snapshot's statistical analysis
 var accessStatistic *statistic
 
+// maps request paths to route templates. nil if resources are grouped
+// by section (c.f. logEntry.resource)
+var routes *routeNormalizer
+
 // ----------------------------------------------------------------------
 // process loop
 
@@ -86,6 +164,9 @@ func main() {
 	var stat int
 	var e error
 
+	initDisplay()
+	initTerminal()
+
 	/// best effort for clean shutdown /////////////////////////////////////
 
 	/* insure cleanup of terminal */
@@ -115,9 +196,74 @@ func main() {
 		stat = 6
 		return
 	}
+	if _, ok := durationUnits[conf.durationUnit]; !ok {
+		e = fmt.Errorf("duration unit (option -duration-unit) must be one of {s, ms, us}.")
+		stat = 6
+		return
+	}
+	if conf.sectionDepth == 0 {
+		e = fmt.Errorf("section depth (option -section-depth) must be non-zero.")
+		stat = 6
+		return
+	}
+
+	if _, ok := shardKeyFields[conf.shardBy]; !ok {
+		e = fmt.Errorf("shard field (option -shard-by) must be one of {host, user, line}.")
+		stat = 6
+		return
+	}
+	if conf.apdexT <= 0 || conf.sloTarget <= 0 || conf.sloTarget >= 100 {
+		e = fmt.Errorf("apdex T (option -apdex-t) must be positive, and availability (option -slo-target) in (0, 100).")
+		stat = 6
+		return
+	}
 
 	/* -- state objects */
 
+	trustedProxies, e = parseProxyList(conf.trustedProxies)
+	if e != nil {
+		stat = 6
+		return
+	}
+	uaRules, e = loadUaClassifier(conf.uaRules)
+	if e != nil {
+		stat = 12
+		return
+	}
+
+	setSelfDomains(conf.selfDomains)
+
+	if conf.queryValues != "" {
+		conf.queryParams = true
+		setQueryValues(conf.queryValues)
+	}
+
+	if conf.byRoute || conf.routeTemplates != "" {
+		routes = newRouteNormalizer(conf.routeBuiltins)
+		if conf.routeTemplates != "" {
+			if e = routes.load(conf.routeTemplates); e != nil {
+				stat = 11
+				return
+			}
+		}
+	}
+
+	objectives, e = loadSloObjectives(conf.sloFile, sloObjective{conf.apdexT, conf.apdexMin, conf.sloTarget / 100})
+	if e != nil {
+		stat = 13
+		return
+	}
+
+	if e = initDimensions(conf.dims); e != nil {
+		stat = 6
+		return
+	}
+	for _, dim := range dimensions {
+		if dim.name != "param" {
+			tableAttributes = append(tableAttributes, dim.name)
+		}
+	}
+
 	alertsJournal = newRingBuffer(conf.alertsJournalSize)
 	logJournal = newRingBuffer(conf.logJournalSize)
 	//	snapshotsPerAlertCheck := uint16(60 * conf.alertPeriodMin / conf.statPeriodSec)
@@ -164,19 +310,51 @@ func main() {
 	/// processing loop ////////////////////////////////////////////////////
 
 	alertChkCountdown := uint16(0)
+	snapshot := func(sharded *shardWip) {
+		// note: REVU comment of the function below addresses high
+		// perofmrance concerns.
+		accessStatistic = accessMetrics.takeSnapshot(sharded)
+		alertChkCountdown++
+		if alertChkCountdown == snapshotsPerAlertCheck {
+			alertChkCountdown = 0
+			checkTraffic()
+		}
+		checkSlos(accessStatistic.slos)
+		checkAnomalies(accessStatistic.anomalies)
+		checkOverflow(accessStatistic)
+		refreshDisplay(false)
+	}
+	pipeline := accessMetrics.pipeline
+	var pipelineOut <-chan *shardBatch  // nil (never ready) if inline
+	var pipelineFlush <-chan time.Time  // partial batches, c.f. pipelineFlushPeriod
+	var pipelineMerged <-chan *shardWip // snapshot hand-offs, c.f. pipeline.swap
+	if pipeline != nil {
+		defer pipeline.stop()
+		pipelineOut = pipeline.out
+		pipelineMerged = pipeline.merged
+		flush_timer := time.NewTicker(pipelineFlushPeriod)
+		defer flush_timer.Stop()
+		pipelineFlush = flush_timer.C
+	}
 	refreshDisplay(true)
 	for {
+		/* batches received while sending to the pipeline */
+		if pipeline != nil {
+			if e = ingestBatches(pipeline.takeReceived()...); e != nil {
+				stat = 5
+				tailproc.stop <- true
+				return
+			}
+		}
 		select {
 		case <-stats_timer.C:
-			// note: REVU comment of the function below addresses high
-			// perofmrance concerns.
-			accessStatistic = accessMetrics.takeSnapshot()
-			alertChkCountdown++
-			if alertChkCountdown == snapshotsPerAlertCheck {
-				alertChkCountdown = 0
-				checkTraffic()
+			if pipeline != nil {
+				pipeline.swap() /* c.f. pipelineMerged */
+				break
 			}
-			refreshDisplay(false)
+			snapshot(nil)
+		case sharded := <-pipelineMerged:
+			snapshot(pipeline.swapped(sharded))
 		case event, ok := <-ui:
 			if !ok {
 				e = fmt.Errorf("ui events channel unepxectedly closed. will exit.")
@@ -185,10 +363,19 @@ func main() {
 				return
 			}
 			switch {
-			case event.is(viewStats, viewAlerts, viewLog, viewDebug):
+			case event.is(viewStats, viewAlerts, viewLog, viewDebug, viewTree, viewParams, viewSessions, viewSlo, viewTotals, viewMovers):
 				setView(event)
 			case event.is(pageUp, pageDown):
 				scrollView(event)
+			case event.is(cursorUp, cursorDown, expandRow, collapseRow):
+				navigateView(event)
+			case event.is(cycleTable, cycleFilter, cycleOrder, cycleReference):
+				setTableOptions(event)
+			case event.is(cycleScope):
+				cycleVhostScope()
+			case event.is(resetTotals):
+				accessMetrics.resetTotals()
+				refreshDisplay(true)
 			case event.is(doQuit):
 				tailproc.stop <- true
 				return
@@ -202,6 +389,10 @@ func main() {
 				stat = 4
 				return
 			}
+			if pipeline != nil {
+				pipeline.dispatch(line)
+				break
+			}
 			entry, err := parseW3cCommonLogFormat(line)
 			if err != nil {
 				e = fmt.Errorf("err - failed to parse tail out - %s\n", err.Error())
@@ -209,10 +400,14 @@ func main() {
 				tailproc.stop <- true
 				return
 			}
-			accessMetrics.Update(entry)
-			logJournal.add(string(line)) // REVU: this optional feature is likely not worth the perf. hit.
-			if currentView.id == logView {
-				displayLog()
+			ingest(line, entry)
+		case <-pipelineFlush:
+			pipeline.flush()
+		case batch := <-pipelineOut:
+			if e = ingestBatches(batch); e != nil {
+				stat = 5
+				tailproc.stop <- true
+				return
 			}
 		case sig := <-interrupt:
 			if tailproc != nil {
@@ -242,6 +437,157 @@ func selfSignal(s os.Signal) error {
 	return proc.Signal(s)
 }
 
+// tracks the parsed access of the line (c.f. metrics.Update) and journals
+// the line.
+func ingest(line []byte, entry *logEntry) {
+	journal(line, entry)
+	if currentView.id == logView {
+		displayLog()
+	}
+}
+
+// tracks the entry and journals the line (of the scope). Lines are owned
+// (c.f. tail) so are journaled as is.
+func journal(line []byte, entry *logEntry) {
+	accessMetrics.Update(entry)
+	if entry == nil || accessMetrics.scope == "" || entry.vhost == accessMetrics.scope {
+		logJournal.add(line)
+	}
+}
+
+// ingests the entries of the pipeline's batches, returning the first
+// parse error. The log view is refreshed per batch.
+func ingestBatches(batches ...*shardBatch) error {
+	for _, batch := range batches {
+		for i, entry := range batch.entries {
+			journal(batch.lines[i], entry)
+		}
+		if batch.e != nil {
+			return batch.e
+		}
+	}
+	if len(batches) > 0 && currentView.id == logView {
+		displayLog()
+	}
+	return nil
+}
+
+// scopes views to the next vhost (in order of last snapshot's traffic),
+// cycling back to unscoped after the last.
+func cycleVhostScope() {
+	var next string
+	if stats := accessStatistic; stats != nil {
+		inOrder := stats.by("vhost").inOrder
+		for n := len(inOrder) - 1; n >= 0; n-- {
+			if accessMetrics.scope == "" {
+				next = inOrder[n].name
+				break
+			}
+			if inOrder[n].name == accessMetrics.scope && n > 0 {
+				next = inOrder[n-1].name
+				break
+			}
+		}
+	}
+	accessMetrics.setScope(next)
+	refreshDisplay(true)
+}
+
+// active SLO alerts by route
+var sloAlerts = make(map[string]*alert)
+
+// checks the SLO status of routes with sufficient traffic in the rolling
+// window, raising an alert on breach and recovering once no longer in
+// breach. Alerts are journaled but not shown in the footer, which is
+// reserved for the traffic alert.
+func checkSlos(statuses []sloStatus) {
+	now := time.Now()
+	inWindow := make(map[string]bool, len(statuses))
+	for i := range statuses {
+		status := &statuses[i]
+		inWindow[status.route] = true
+		breach := status.breach()
+		active := sloAlerts[status.route]
+		switch {
+		case breach != "" && active == nil && status.window.total >= sloAlertMinRequests:
+			raised, _ := newSloAlert(status.route, breach, now) /* safe to not check error here */
+			sloAlerts[status.route] = raised
+			alertsJournal.add(raised)
+		case breach == "" && active != nil:
+			recovered, _ := active.recovered(now)
+			delete(sloAlerts, status.route)
+			alertsJournal.add(recovered)
+		}
+	}
+	/* routes with no traffic in the window have recovered */
+	for route, active := range sloAlerts {
+		if !inWindow[route] {
+			recovered, _ := active.recovered(now)
+			delete(sloAlerts, route)
+			alertsJournal.add(recovered)
+		}
+	}
+}
+
+// raised anomaly alerts by measure name (c.f. anomaly)
+var anomalyAlerts = make(map[string]*alert)
+
+// raises an alert for measures deviating from the seasonal baseline by
+// more than conf.anomalyZ, and recovers those that no longer do (or are
+// no longer scored).
+func checkAnomalies(anomalies []anomaly) {
+	if conf.anomalyZ <= 0 {
+		return
+	}
+	now := time.Now()
+	scored := make(map[string]bool, len(anomalies))
+	for _, a := range anomalies {
+		scored[a.name] = true
+		anomalous := math.Abs(a.z()) >= conf.anomalyZ
+		active := anomalyAlerts[a.name]
+		switch {
+		case anomalous && active == nil:
+			raised, _ := newAnomalyAlert(a, now) /* safe to not check error here */
+			anomalyAlerts[a.name] = raised
+			alertsJournal.add(raised)
+		case !anomalous && active != nil:
+			recovered, _ := active.recovered(now)
+			delete(anomalyAlerts, a.name)
+			alertsJournal.add(recovered)
+		}
+	}
+	for name, active := range anomalyAlerts {
+		if !scored[name] {
+			recovered, _ := active.recovered(now)
+			delete(anomalyAlerts, name)
+			alertsJournal.add(recovered)
+		}
+	}
+}
+
+// last time a dimension was noticed overflowing its cap (c.f. conf.maxKeys)
+var overflowed = make(map[string]time.Time)
+
+// dimensions overflowing within this period of the last notice are not
+// noticed again
+const overflowNoticeHoldoff = 10 * time.Minute
+
+// raises a notice for dimensions that overflowed their key cap in the
+// snapshot, unless recently noticed.
+func checkOverflow(stats *statistic) {
+	now := time.Now()
+	for name, data := range stats.byDimension {
+		if data.folded == 0 {
+			continue
+		}
+		if last, ok := overflowed[name]; !ok || now.Sub(last) > overflowNoticeHoldoff {
+			notice, _ := newOverflowNotice(name, conf.maxKeys, data.foldedKeys, now) /* safe to not check error here */
+			alertsJournal.add(notice)
+			overflowed[name] = now
+		}
+	}
+}
+
 // checks total traffic for the sliding time window and
 // updates activeAlert per results.
 func checkTraffic() {
@@ -0,0 +1,84 @@
+//    Copyright © 2016 Joubin Houshyar. All rights reserved.
+//
+//    This file is part of puppy.
+//
+//    puppy is free software: you can redistribute it and/or modify
+//    it under the terms of the GNU Affero General Public License as
+//    published by the Free Software Foundation, either version 3 of
+//    the License, or (at your option) any later version.
+//
+//    puppy is distributed in the hope that it will be useful,
+//    but WITHOUT ANY WARRANTY; without even the implied warranty of
+//    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//    GNU Affero General Public License for more details.
+//
+//    You should have received a copy of the GNU Affero General Public
+//    License along with puppy.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// General note:
+// Query parameter analytics are optional (c.f. conf.queryParams) and are
+// tracked per resource (route or section). Parameter names are always
+// counted, but values are only counted for allow-listed parameters, as
+// values are typically unbounded (and may well be sensitive).
+//
+// Keys are of form <resource>?<name> and <resource>?<name>=<value>, e.g.
+//
+//    /search?q
+//    /search?q=puppy
+//    /?utm_source=newsletter
+
+// allow-listed parameter names whose values are tracked. Set from
+// conf.queryValues on startup.
+var queryValues = make(map[string]bool)
+
+func setQueryValues(csv string) {
+	for _, name := range strings.Split(csv, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			queryValues[name] = true
+		}
+	}
+}
+
+// returns the query parameter keys of the access, which is nil if
+// the request has no (well-formed) query. Repeated params are counted
+// once per distinct name (and value).
+func queryKeys(access *logEntry) []string {
+	if access.uri.RawQuery == "" {
+		return nil
+	}
+	params, e := url.ParseQuery(access.uri.RawQuery)
+	if e != nil && len(params) == 0 {
+		return nil
+	}
+	names := make([]string, 0, len(params))
+	for name := range params {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	resource := access.resource()
+	keys := make([]string, 0, len(names))
+	for _, name := range names {
+		key := resource + "?" + name
+		keys = append(keys, key)
+		if !queryValues[name] {
+			continue
+		}
+		seen := make(map[string]bool)
+		for _, value := range params[name] {
+			if value = strings.TrimSpace(value); value != "" && !seen[value] {
+				seen[value] = true
+				keys = append(keys, key+"="+value)
+			}
+		}
+	}
+	return keys
+}
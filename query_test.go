@@ -0,0 +1,57 @@
+// friend
+
+//    Copyright © 2016 Joubin Houshyar. All rights reserved.
+//
+//    This file is part of puppy.
+//
+//    puppy is free software: you can redistribute it and/or modify
+//    it under the terms of the GNU Affero General Public License as
+//    published by the Free Software Foundation, either version 3 of
+//    the License, or (at your option) any later version.
+//
+//    puppy is distributed in the hope that it will be useful,
+//    but WITHOUT ANY WARRANTY; without even the implied warranty of
+//    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//    GNU Affero General Public License for more details.
+//
+//    You should have received a copy of the GNU Affero General Public
+//    License along with puppy.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+func TestQueryKeys(t *testing.T) {
+	defer func(values map[string]bool) { queryValues = values }(queryValues)
+	queryValues = make(map[string]bool)
+	setQueryValues(" q, ,lang")
+
+	tests := []struct {
+		uri  string
+		keys []string
+	}{
+		{"/search", nil},
+		{"/search?", nil},
+		{"/search?q=puppy", []string{"/search?q", "/search?q=puppy"}},
+		{"/search/more?page=2&q=a", []string{"/search?page", "/search?q", "/search?q=a"}},
+		{"/?q=a&q=a&q=b&q=+", []string{"/?q", "/?q=a", "/?q=b"}},
+		{"/?utm_source=news&utm_source=mail", []string{"/?utm_source"}},
+		{"/?lang=en&flag", []string{"/?flag", "/?lang", "/?lang=en"}},
+		{"/?q=%zz&page=1", []string{"/?page"}},
+		{"/?%zz", nil},
+	}
+	for _, test := range tests {
+		uri, e := url.ParseRequestURI(test.uri)
+		if e != nil {
+			t.Fatal(e)
+		}
+		keys := queryKeys(&logEntry{uri: uri})
+		if !reflect.DeepEqual(keys, test.keys) {
+			t.Errorf("%s - got %q, expected %q", test.uri, keys, test.keys)
+		}
+	}
+}
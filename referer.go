@@ -0,0 +1,96 @@
+//    Copyright © 2016 Joubin Houshyar. All rights reserved.
+//
+//    This file is part of puppy.
+//
+//    puppy is free software: you can redistribute it and/or modify
+//    it under the terms of the GNU Affero General Public License as
+//    published by the Free Software Foundation, either version 3 of
+//    the License, or (at your option) any later version.
+//
+//    puppy is distributed in the hope that it will be useful,
+//    but WITHOUT ANY WARRANTY; without even the implied warranty of
+//    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//    GNU Affero General Public License for more details.
+//
+//    You should have received a copy of the GNU Affero General Public
+//    License along with puppy.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"net/url"
+	"strings"
+)
+
+// General note:
+// Combined Log Format referers are normalized to their domain, i.e. the
+// lower cased host sans port and 'www.' prefix. Referers from the site
+// itself (the request's vhost, or any of conf.selfDomains and their
+// subdomains) are internal, and all others external. The external
+// referer and the route it landed on are dimensions (c.f. fieldKeyFns).
+
+const (
+	refererDirect   = "(direct)"   // no referer
+	refererInternal = "(internal)" // self referral
+	refererInvalid  = "(invalid)"  // not a URL with a host
+)
+
+// the site's own domains. Set from conf.selfDomains on startup.
+var selfDomains []string
+
+func setSelfDomains(csv string) {
+	selfDomains = nil
+	for _, domain := range strings.Split(csv, ",") {
+		if domain = strings.TrimSpace(domain); domain != "" {
+			selfDomains = append(selfDomains, stripWww(strings.ToLower(domain)))
+		}
+	}
+}
+
+func stripWww(host string) string { return strings.TrimPrefix(host, "www.") }
+
+// returns the domain of the referer, or refererDirect if there is none,
+// or refererInvalid.
+func refererDomain(referer string) string {
+	if referer == "" || referer == "-" {
+		return refererDirect
+	}
+	u, e := url.Parse(referer)
+	if e != nil || u.Hostname() == "" {
+		return refererInvalid
+	}
+	return stripWww(strings.ToLower(u.Hostname()))
+}
+
+// returns true if the domain is the vhost or a self domain (or subdomain
+// thereof).
+func isSelfDomain(domain, vhost string) bool {
+	if vhost != "" && domain == stripWww(vhost) {
+		return true
+	}
+	for _, self := range selfDomains {
+		if domain == self || strings.HasSuffix(domain, "."+self) {
+			return true
+		}
+	}
+	return false
+}
+
+// returns the referer domain of the access, with self referrals as
+// refererInternal.
+func (p *logEntry) refererDomain() string {
+	domain := refererDomain(p.referer)
+	if domain[0] != '(' && isSelfDomain(domain, p.vhost) {
+		return refererInternal
+	}
+	return domain
+}
+
+// returns the external referer domain of the access, or "" if the
+// access is direct, internal, or has an invalid referer.
+func (p *logEntry) externalReferer() string {
+	if domain := p.refererDomain(); domain[0] != '(' {
+		return domain
+	}
+	return ""
+}
@@ -49,6 +49,11 @@ func (r *ringBuffer) add(item interface{}) {
 	return
 }
 
+// returns the item the next add evicts, nil if not full
+func (r *ringBuffer) next() interface{} {
+	return r.buf[r.xof]
+}
+
 // return (up to max) last (FILO) entries
 func (r *ringBuffer) last(max uint) []interface{} {
 	if max > r.cap {
@@ -0,0 +1,178 @@
+//    Copyright © 2016 Joubin Houshyar. All rights reserved.
+//
+//    This file is part of puppy.
+//
+//    puppy is free software: you can redistribute it and/or modify
+//    it under the terms of the GNU Affero General Public License as
+//    published by the Free Software Foundation, either version 3 of
+//    the License, or (at your option) any later version.
+//
+//    puppy is distributed in the hope that it will be useful,
+//    but WITHOUT ANY WARRANTY; without even the implied warranty of
+//    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//    GNU Affero General Public License for more details.
+//
+//    You should have received a copy of the GNU Affero General Public
+//    License along with puppy.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// General note:
+// metrics.traffic only spans the alert window. Rollups keep the snapshot
+// stream at multiple resolutions (tiers), each a ring of time aligned
+// buckets of merged access counters, e.g. per second for 10 minutes, per
+// minute for a day, and per hour for 30 days. Everything is in memory so
+// history is lost on restart.
+
+// the default tiers. Route counts (of the top routes of snapshots) are
+// only kept by the coarser tiers (c.f. baseline).
+var rollupTiers = []struct {
+	resolution time.Duration
+	buckets    uint
+	routes     bool
+}{
+	{time.Second, 600, false},
+	{time.Minute, 24 * 60, true},
+	{time.Hour, 30 * 24, true},
+}
+
+// bounds the routes of a bucket
+const rollupMaxRoutes = 100
+
+type rollupBucket struct {
+	start   time.Time
+	counter *accessCounter
+	routes  map[string]uint // nil if not kept
+}
+
+type rollupTier struct {
+	resolution time.Duration
+	buckets    *ringBuffer // <*rollupBucket> : completed buckets
+	current    *rollupBucket
+	routes     bool
+}
+
+func (p *rollupTier) add(ts time.Time, cnt *accessCounter, routes map[string]uint) {
+	start := ts.Truncate(p.resolution)
+	if p.current != nil && !p.current.start.Equal(start) {
+		p.buckets.add(p.current)
+		p.current = nil
+	}
+	if p.current == nil {
+		p.current = &rollupBucket{start: start, counter: &accessCounter{}}
+		if p.routes {
+			p.current.routes = make(map[string]uint)
+		}
+	}
+	p.current.counter.merge(cnt.counts())
+	if p.routes {
+		for route, n := range routes {
+			if _, ok := p.current.routes[route]; ok || len(p.current.routes) < rollupMaxRoutes {
+				p.current.routes[route] += n
+			}
+		}
+	}
+}
+
+// returns the buckets (current first) in FILO order
+func (p *rollupTier) series() []*rollupBucket {
+	items := p.buckets.items()
+	series := make([]*rollupBucket, 0, len(items)+1)
+	if p.current != nil {
+		series = append(series, p.current)
+	}
+	for _, obj := range items {
+		series = append(series, obj.(*rollupBucket))
+	}
+	return series
+}
+
+type rollups struct {
+	tiers []*rollupTier // finest first
+}
+
+func newRollups() *rollups {
+	p := &rollups{}
+	for _, tier := range rollupTiers {
+		p.tiers = append(p.tiers, &rollupTier{tier.resolution, newRingBuffer(tier.buckets), nil, tier.routes})
+	}
+	return p
+}
+
+// adds the snapshot counts (of the period starting at ts), and the counts
+// of its top routes, to all tiers
+func (p *rollups) add(ts time.Time, cnt *accessCounter, routes map[string]uint) {
+	for _, tier := range p.tiers {
+		tier.add(ts, cnt, routes)
+	}
+}
+
+// returns the counts of the buckets starting in the window [to-d, to),
+// per the finest tier that spans it, or error if no tier does. Windows
+// are thus bucket aligned, e.g. per the minute tier the window is rounded
+// to whole minutes.
+func (p *rollups) window(to time.Time, d time.Duration) (*accessCounter, error) {
+	from := to.Add(-d)
+	for _, tier := range p.tiers {
+		series := tier.series()
+		if d < tier.resolution || len(series) == 0 || from.Before(series[len(series)-1].start) {
+			continue
+		}
+		sum := &accessCounter{}
+		for _, bucket := range series {
+			if bucket.start.Before(from) {
+				break
+			}
+			if bucket.start.Before(to) {
+				sum.merge(bucket.counter)
+			}
+		}
+		return sum, nil
+	}
+	return nil, fmt.Errorf("err - rollups.window - no tier spans %s to %s", d, to.Format(time.RFC3339))
+}
+
+// ----------------------------------------------------------------------
+// comparisons
+
+// compares the traffic of the last window with the same window 'ago'. ok
+// is false if the rollups don't span it (e.g. puppy hasn't been running
+// long enough).
+type rollupComparison struct {
+	window, ago   time.Duration
+	current, then uint
+	ok            bool
+}
+
+// the comparisons reported in the stats view
+var rollupComparisons = []struct{ window, ago time.Duration }{
+	{time.Minute, time.Hour},
+	{time.Hour, 24 * time.Hour},
+}
+
+func (p *rollups) compare(now time.Time, window, ago time.Duration) rollupComparison {
+	cmp := rollupComparison{window: window, ago: ago}
+	current, e := p.window(now, window)
+	if e != nil {
+		return cmp
+	}
+	then, e := p.window(now.Add(-ago), window)
+	if e != nil {
+		return cmp
+	}
+	cmp.current, cmp.then, cmp.ok = current.total, then.total, true
+	return cmp
+}
+
+// relative change, or 0 if then is 0
+func (p rollupComparison) change() float64 {
+	if p.then == 0 {
+		return 0
+	}
+	return float64(p.current)/float64(p.then) - 1
+}
@@ -0,0 +1,105 @@
+// friend
+
+//    Copyright © 2016 Joubin Houshyar. All rights reserved.
+//
+//    This file is part of puppy.
+//
+//    puppy is free software: you can redistribute it and/or modify
+//    it under the terms of the GNU Affero General Public License as
+//    published by the Free Software Foundation, either version 3 of
+//    the License, or (at your option) any later version.
+//
+//    puppy is distributed in the hope that it will be useful,
+//    but WITHOUT ANY WARRANTY; without even the implied warranty of
+//    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//    GNU Affero General Public License for more details.
+//
+//    You should have received a copy of the GNU Affero General Public
+//    License along with puppy.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+var rollupStart = time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// adds a snapshot per second over mins minutes, of 1 access for the
+// first 5 minutes and 2 after
+func secondRollups(t *testing.T, mins int) *rollups {
+	testUaRules(t)
+	p := newRollups()
+	for s := 0; s < mins*60; s++ {
+		cnt, n := &accessCounter{}, 1
+		if s >= 300 {
+			n = 2
+		}
+		for i := 0; i < n; i++ {
+			cnt.Update(testAccess("GET", 200, 100))
+		}
+		p.add(rollupStart.Add(time.Duration(s)*time.Second), cnt, nil)
+	}
+	return p
+}
+
+func TestRollupWindow(t *testing.T) {
+	p := secondRollups(t, 11)
+	at := func(d time.Duration) time.Time { return rollupStart.Add(d) }
+	tests := []struct {
+		name  string
+		to    time.Time
+		d     time.Duration
+		total uint
+	}{
+		{"seconds", at(11 * time.Minute), 30 * time.Second, 60},
+		{"a second", at(5*time.Minute + time.Second), time.Second, 2},
+		{"before a bucket", at(5 * time.Minute), time.Second, 1},
+		{"seconds, 5m", at(11 * time.Minute), 5 * time.Minute, 600},
+		/* the second tier has rolled over, so per the minute tier */
+		{"minutes", at(11 * time.Minute), 11 * time.Minute, 300 + 6*120},
+		/* buckets of minutes 1 to 5, i.e. rounded to whole minutes */
+		{"minute aligned", at(5*time.Minute + 30*time.Second), 5 * time.Minute, 4*60 + 120},
+		{"no buckets", at(time.Hour), time.Minute, 0},
+	}
+	for _, test := range tests {
+		cnt, e := p.window(test.to, test.d)
+		if e != nil {
+			t.Errorf("%s - %v", test.name, e)
+		} else if cnt.total != test.total {
+			t.Errorf("%s - total %d, expected %d", test.name, cnt.total, test.total)
+		}
+	}
+	/* not spanned by any tier */
+	for _, test := range []struct{ to, d time.Duration }{
+		{11 * time.Minute, 12 * time.Minute},
+		{30 * time.Second, 10 * time.Second}, /* rolled over, and under a minute */
+	} {
+		if _, e := p.window(at(test.to), test.d); e == nil {
+			t.Errorf("%s to %s - expected an error", test.d, test.to)
+		}
+	}
+	if _, e := newRollups().window(rollupStart, time.Minute); e == nil {
+		t.Errorf("empty - expected an error")
+	}
+}
+
+func TestRollupCompare(t *testing.T) {
+	now := rollupStart.Add(11 * time.Minute)
+	if cmp := newRollups().compare(now, time.Minute, time.Hour); cmp.ok {
+		t.Errorf("empty - expected not ok")
+	}
+	p := secondRollups(t, 11)
+	/* no prior window */
+	if cmp := p.compare(now, time.Minute, time.Hour); cmp.ok || cmp.change() != 0 {
+		t.Errorf("missing prior window - expected not ok, got %+v", cmp)
+	}
+	cmp := p.compare(now, time.Minute, 7*time.Minute)
+	if !cmp.ok || cmp.current != 120 || cmp.then != 60 || cmp.change() != 1 {
+		t.Errorf("expected 120 from 60, got %+v", cmp)
+	}
+	if cmp := (rollupComparison{current: 10, ok: true}); cmp.change() != 0 {
+		t.Errorf("then 0 - change %f", cmp.change())
+	}
+}
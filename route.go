@@ -0,0 +1,213 @@
+//    Copyright © 2016 Joubin Houshyar. All rights reserved.
+//
+//    This file is part of puppy.
+//
+//    puppy is free software: you can redistribute it and/or modify
+//    it under the terms of the GNU Affero General Public License as
+//    published by the Free Software Foundation, either version 3 of
+//    the License, or (at your option) any later version.
+//
+//    puppy is distributed in the hope that it will be useful,
+//    but WITHOUT ANY WARRANTY; without even the implied warranty of
+//    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//    GNU Affero General Public License for more details.
+//
+//    You should have received a copy of the GNU Affero General Public
+//    License along with puppy.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// General note:
+// Grouping by section (the first path segment) keeps resource cardinality
+// low but is too coarse, while grouping by raw path explodes on ids, e.g.
+// /users/123/orders/9f8e... A route normalizer maps paths to logical route
+// templates, e.g. /users/:id/orders/:uuid, first per user supplied templates
+// (which win) and then per the built-in segment rules below.
+
+// placeholders substituted by the built-in rules
+const (
+	routeParamId   = ":id"
+	routeParamUuid = ":uuid"
+	routeParamHash = ":hash"
+)
+
+// a user supplied route template, e.g. /api/v1/users/:user/*
+// segments prefixed with ':' match any single path segment, and a
+// terminal '*' matches the remainder (of zero or more segments).
+type routeTemplate struct {
+	route    string
+	segments []string
+	wildcard bool
+}
+
+func newRouteTemplate(route string) (*routeTemplate, error) {
+	if !strings.HasPrefix(route, "/") {
+		return nil, fmt.Errorf("err - newRouteTemplate - route must be absolute: %q", route)
+	}
+	p := &routeTemplate{route: route}
+	p.segments = splitPath(route)
+	if n := len(p.segments); n > 0 && p.segments[n-1] == "*" {
+		p.segments = p.segments[:n-1]
+		p.wildcard = true
+	}
+	for _, seg := range p.segments {
+		switch seg {
+		case "*":
+			return nil, fmt.Errorf("err - newRouteTemplate - '*' must be terminal: %q", route)
+		case "":
+			return nil, fmt.Errorf("err - newRouteTemplate - empty segment: %q", route)
+		}
+	}
+	return p, nil
+}
+
+func (p *routeTemplate) matches(segments []string) bool {
+	if len(segments) < len(p.segments) || (!p.wildcard && len(segments) != len(p.segments)) {
+		return false
+	}
+	for i, seg := range p.segments {
+		if !strings.HasPrefix(seg, ":") && seg != segments[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// ----------------------------------------------------------------------
+// normalizer
+
+type routeNormalizer struct {
+	templates []*routeTemplate // in order of precedence
+	builtins  bool
+}
+
+func newRouteNormalizer(builtins bool) *routeNormalizer {
+	return &routeNormalizer{nil, builtins}
+}
+
+// loads templates from the named file, one per line. Blank lines and
+// '#' comments are ignored. Templates are matched in file order.
+func (p *routeNormalizer) load(fname string) error {
+	file, e := os.Open(fname)
+	if e != nil {
+		return fmt.Errorf("err - routeNormalizer.load - %s", e.Error())
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		template, e := newRouteTemplate(line)
+		if e != nil {
+			return fmt.Errorf("err - routeNormalizer.load - %s:%d - %s", fname, n, e.Error())
+		}
+		p.templates = append(p.templates, template)
+	}
+	return scanner.Err()
+}
+
+// returns the route template of the given path. If no user template
+// matches, ids, uuids, and hashes are collapsed per the built-in rules
+// (if enabled). Paths that match nothing are returned as is.
+func (p *routeNormalizer) normalize(path string) string {
+	segments := splitPath(path)
+	for _, template := range p.templates {
+		if template.matches(segments) {
+			return template.route
+		}
+	}
+	if !p.builtins || len(segments) == 0 {
+		return path
+	}
+	for i, seg := range segments {
+		switch {
+		case isNumericId(seg):
+			segments[i] = routeParamId
+		case isUuid(seg):
+			segments[i] = routeParamUuid
+		case isHash(seg):
+			segments[i] = routeParamHash
+		}
+	}
+	route := "/" + strings.Join(segments, "/")
+	if strings.HasSuffix(path, "/") && len(segments) > 0 {
+		route += "/"
+	}
+	return route
+}
+
+// ----------------------------------------------------------------------
+// built-in rules
+
+func splitPath(path string) []string {
+	path = strings.Trim(path, "/")
+	if path == "" {
+		return []string{}
+	}
+	return strings.Split(path, "/")
+}
+
+func isNumericId(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, b := range []byte(s) {
+		if b < '0' || b > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// canonical 8-4-4-4-12 hex form
+func isUuid(s string) bool {
+	if len(s) != 36 {
+		return false
+	}
+	for i, b := range []byte(s) {
+		switch i {
+		case 8, 13, 18, 23:
+			if b != '-' {
+				return false
+			}
+		default:
+			if !isHexDigit(b) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// hex strings of at least 16 digits (e.g. md5, sha1, sha256, object ids)
+// that contain at least one digit, so /deadbeefcafebabe words aren't
+// mistaken for hashes.
+func isHash(s string) bool {
+	if len(s) < 16 {
+		return false
+	}
+	digits := 0
+	for _, b := range []byte(s) {
+		if !isHexDigit(b) {
+			return false
+		}
+		if b >= '0' && b <= '9' {
+			digits++
+		}
+	}
+	return digits > 0
+}
+
+func isHexDigit(b byte) bool {
+	return (b >= '0' && b <= '9') || (b >= 'a' && b <= 'f') || (b >= 'A' && b <= 'F')
+}
@@ -0,0 +1,50 @@
+//    Copyright © 2016 Joubin Houshyar. All rights reserved.
+//
+//    This file is part of puppy.
+//
+//    puppy is free software: you can redistribute it and/or modify
+//    it under the terms of the GNU Affero General Public License as
+//    published by the Free Software Foundation, either version 3 of
+//    the License, or (at your option) any later version.
+//
+//    puppy is distributed in the hope that it will be useful,
+//    but WITHOUT ANY WARRANTY; without even the implied warranty of
+//    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//    GNU Affero General Public License for more details.
+//
+//    You should have received a copy of the GNU Affero General Public
+//    License along with puppy.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import "testing"
+
+func TestRouteTemplates(t *testing.T) {
+	for _, route := range []string{"a/b", "/a//b", "/a/*/b"} {
+		if _, e := newRouteTemplate(route); e == nil {
+			t.Errorf("%q - expected error", route)
+		}
+	}
+	p := newRouteNormalizer(true)
+	for _, route := range []string{"/api/v1/users/:user/*", "/static/*", "/a/:x/b"} {
+		template, e := newRouteTemplate(route)
+		if e != nil {
+			t.Fatalf("%q - %s", route, e)
+		}
+		p.templates = append(p.templates, template)
+	}
+	tests := []struct{ path, route string }{
+		{"/api/v1/users/jane", "/api/v1/users/:user/*"},
+		{"/api/v1/users/jane/orders/1", "/api/v1/users/:user/*"},
+		{"/static", "/static/*"},
+		{"/a/1/b", "/a/:x/b"},
+		{"/orders/123", "/orders/:id"},
+		{"/orders/123/", "/orders/:id/"},
+		{"/", "/"},
+	}
+	for _, test := range tests {
+		if route := p.normalize(test.path); route != test.route {
+			t.Errorf("%q - got %q, expected %q", test.path, route, test.route)
+		}
+	}
+}
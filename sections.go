@@ -0,0 +1,158 @@
+//    Copyright © 2016 Joubin Houshyar. All rights reserved.
+//
+//    This file is part of puppy.
+//
+//    puppy is free software: you can redistribute it and/or modify
+//    it under the terms of the GNU Affero General Public License as
+//    published by the Free Software Foundation, either version 3 of
+//    the License, or (at your option) any later version.
+//
+//    puppy is distributed in the hope that it will be useful,
+//    but WITHOUT ANY WARRANTY; without even the implied warranty of
+//    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//    GNU Affero General Public License for more details.
+//
+//    You should have received a copy of the GNU Affero General Public
+//    License along with puppy.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"fmt"
+	"sort"
+)
+
+// General note:
+// section() is the single level view of the path hierarchy. sectionTree
+// maintains the full prefix tree (to a configured depth) with counts at
+// every level, e.g. /api, /api/v1, /api/v1/users. Like measures, a tree
+// is accumulated per snapshot period. If routes are configured the tree
+// is built from the route templates so ids don't explode the fan-out.
+// Either way the children of each node are capped like the dimensions
+// (c.f. conf.maxKeys), the rest folded into an otherKey leaf.
+
+type sectionNode struct {
+	name     string // path segment
+	path     string // full path to (and including) this node
+	counter  *accessCounter
+	children map[string]*sectionNode
+}
+
+func newSectionNode(name, path string) *sectionNode {
+	return &sectionNode{name, path, &accessCounter{}, make(map[string]*sectionNode)}
+}
+
+// returns children in descending order of total, with ties broken by
+// name so rendering is stable across refreshes.
+func (p *sectionNode) inOrder() []*sectionNode {
+	children := make([]*sectionNode, 0, len(p.children))
+	for _, child := range p.children {
+		children = append(children, child)
+	}
+	sort.Slice(children, func(i, j int) bool {
+		a, b := children[i], children[j]
+		if a.counter.total != b.counter.total {
+			return a.counter.total > b.counter.total
+		}
+		return a.name < b.name
+	})
+	return children
+}
+
+type sectionTree struct {
+	root  *sectionNode
+	depth uint
+	cap   uint // children per node, 0 if uncapped
+}
+
+func newSectionTree(depth, cap uint) *sectionTree {
+	return &sectionTree{newSectionNode("", "/"), depth, cap}
+}
+
+// returns the child of the node for the segment, created if need be, or
+// the node's otherKey child if the node is full.
+func (p *sectionTree) child(node *sectionNode, seg string) *sectionNode {
+	child, ok := node.children[seg]
+	if ok {
+		return child
+	}
+	if p.cap > 0 && uint(len(node.children)) >= p.cap {
+		seg = otherKey
+		if child, ok = node.children[seg]; ok {
+			return child
+		}
+	}
+	childPath := node.path + "/" + seg
+	if node == p.root {
+		childPath = "/" + seg
+	}
+	child = newSectionNode(seg, childPath)
+	node.children[seg] = child
+	return child
+}
+
+// counts the access at every level of its path, up to tree depth.
+func (p *sectionTree) Update(access *logEntry) error {
+	if access == nil {
+		return fmt.Errorf("err - sectionTree.update - assert - access is nil")
+	}
+	path := access.uri.Path
+	if routes != nil {
+		path = routes.normalize(path)
+	}
+	node := p.root
+	node.counter.Update(access)
+	for i, seg := range splitPath(path) {
+		if uint(i) == p.depth {
+			break
+		}
+		child := p.child(node, seg)
+		child.counter.Update(access)
+		if child.name == otherKey {
+			break
+		}
+		node = child
+	}
+	return nil
+}
+
+// adds the counts of other (of the same depth and cap) to the receiver.
+// Children folded on either side are merged into otherKey, whole.
+func (p *sectionTree) merge(other *sectionTree) {
+	var walk func(node, from *sectionNode)
+	walk = func(node, from *sectionNode) {
+		node.counter.merge(from.counter)
+		for _, fromChild := range from.inOrder() {
+			child := p.child(node, fromChild.name)
+			if child.name == otherKey {
+				child.counter.merge(fromChild.counter)
+				continue
+			}
+			walk(child, fromChild)
+		}
+	}
+	walk(p.root, other.root)
+}
+
+// a visible row of the (flattened) tree
+type sectionRow struct {
+	node  *sectionNode
+	level uint
+}
+
+// flattens the tree, depth first, descending only into the expanded
+// nodes (keyed by path). The root itself is not included.
+func (p *sectionTree) visible(expanded map[string]bool) []sectionRow {
+	var rows []sectionRow
+	var walk func(node *sectionNode, level uint)
+	walk = func(node *sectionNode, level uint) {
+		for _, child := range node.inOrder() {
+			rows = append(rows, sectionRow{child, level})
+			if expanded[child.path] {
+				walk(child, level+1)
+			}
+		}
+	}
+	walk(p.root, 0)
+	return rows
+}
@@ -0,0 +1,92 @@
+//    Copyright © 2016 Joubin Houshyar. All rights reserved.
+//
+//    This file is part of puppy.
+//
+//    puppy is free software: you can redistribute it and/or modify
+//    it under the terms of the GNU Affero General Public License as
+//    published by the Free Software Foundation, either version 3 of
+//    the License, or (at your option) any later version.
+//
+//    puppy is distributed in the hope that it will be useful,
+//    but WITHOUT ANY WARRANTY; without even the implied warranty of
+//    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//    GNU Affero General Public License for more details.
+//
+//    You should have received a copy of the GNU Affero General Public
+//    License along with puppy.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"net/url"
+	"testing"
+)
+
+func TestSectionTreeCap(t *testing.T) {
+	access := func(path string) *logEntry { return &logEntry{uri: &url.URL{Path: path}} }
+	tree := newSectionTree(3, 2)
+	for _, path := range []string{"/a/x", "/a/y", "/a/z/1", "/b", "/c/d", "/c"} {
+		tree.Update(access(path))
+	}
+	if n := len(tree.root.children); n != 3 {
+		t.Fatalf("expected 2 children and otherKey, got %d", n)
+	}
+	other := tree.root.children[otherKey]
+	if other == nil || other.counter.total != 2 || len(other.children) != 0 {
+		t.Fatalf("expected the /c accesses folded into a leaf, got %+v", other)
+	}
+	if a := tree.root.children["a"]; a.children[otherKey].counter.total != 1 || a.counter.total != 3 {
+		t.Errorf("expected /a/z folded, got %d children", len(a.children))
+	}
+
+	merged := newSectionTree(3, 2)
+	merged.Update(access("/e"))
+	merged.merge(tree)
+	if total := merged.root.counter.total; total != 7 {
+		t.Errorf("expected 7 accesses, got %d", total)
+	}
+	if n := len(merged.root.children); n != 3 {
+		t.Errorf("expected 2 children and otherKey once merged, got %d", n)
+	}
+	if other := merged.root.children[otherKey]; other == nil || other.counter.total != 3 {
+		t.Errorf("expected /b and /c folded, got %+v", other)
+	}
+}
+
+func TestSectionTreeCapKeys(t *testing.T) {
+	access := func(path string) *logEntry { return &logEntry{uri: &url.URL{Path: path}} }
+	paths := []string{"/a/x", "/b", "/c", "/d/y", "/a/z", "/b"}
+	tests := []struct {
+		cap      uint
+		children []string // of the root, by path
+		totals   []uint
+	}{
+		{0, []string{"/a", "/b", "/c", "/d"}, []uint{2, 2, 1, 1}},
+		{1, []string{"/a", "/(other)"}, []uint{2, 4}},
+		{2, []string{"/a", "/b", "/(other)"}, []uint{2, 2, 2}},
+	}
+	for _, test := range tests {
+		tree := newSectionTree(2, test.cap)
+		for _, path := range paths {
+			tree.Update(access(path))
+		}
+		if len(tree.root.children) != len(test.children) {
+			t.Errorf("cap %d - %d children, expected %v", test.cap, len(tree.root.children), test.children)
+			continue
+		}
+		for i, path := range test.children {
+			var node *sectionNode
+			for _, child := range tree.root.children {
+				if child.path == path {
+					node = child
+				}
+			}
+			if node == nil || node.counter.total != test.totals[i] {
+				t.Errorf("cap %d - %s, expected %d accesses, got %+v", test.cap, path, test.totals[i], node)
+			}
+		}
+		if a := tree.root.children["a"]; test.cap == 1 && (len(a.children) != 2 || a.children[otherKey] == nil || a.children[otherKey].path != "/a/(other)") {
+			t.Errorf("cap 1 - expected /a/z folded into /a/(other), got %v", a.children)
+		}
+	}
+}
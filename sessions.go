@@ -0,0 +1,299 @@
+//    Copyright © 2016 Joubin Houshyar. All rights reserved.
+//
+//    This file is part of puppy.
+//
+//    puppy is free software: you can redistribute it and/or modify
+//    it under the terms of the GNU Affero General Public License as
+//    published by the Free Software Foundation, either version 3 of
+//    the License, or (at your option) any later version.
+//
+//    puppy is distributed in the hope that it will be useful,
+//    but WITHOUT ANY WARRANTY; without even the implied warranty of
+//    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//    GNU Affero General Public License for more details.
+//
+//    You should have received a copy of the GNU Affero General Public
+//    License along with puppy.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// General note:
+// A session is the page views of a visitor, i.e. the authenticated user
+// or else the host and user-agent, with no gap longer than the inactivity
+// timeout (c.f. conf.sessionTimeoutMin). Bots and static assets are not
+// page views. The landing and exit routes are those of the first and last
+// page views. Sessions are only known to have ended after the timeout, so
+// length and pages per session are of the sessions closed in the last
+// hour, and sessions are reported unscoped.
+//
+// Time is the wall clock at update (as with snapshots) and not the log
+// timestamp.
+//
+// Tracking is opt-in (-session-timeout), and the active sessions are
+// bounded (c.f. sessionsMaxActive), with the least recently active
+// sessions closed early to make room.
+
+// extensions of requests that are not page views
+var assetExtensions = map[string]bool{
+	".css": true, ".js": true, ".map": true, ".json": true, ".xml": true, ".txt": true,
+	".png": true, ".jpg": true, ".jpeg": true, ".gif": true, ".svg": true, ".ico": true, ".webp": true,
+	".woff": true, ".woff2": true, ".ttf": true, ".eot": true,
+	".mp4": true, ".webm": true, ".mp3": true, ".pdf": true, ".zip": true,
+}
+
+func isPageView(access *logEntry) bool {
+	return !access.classify().isBot() && !assetExtensions[strings.ToLower(path.Ext(access.uri.Path))]
+}
+
+// the visitor of the access
+func sessionKey(access *logEntry) string {
+	if access.user != "-" && access.user != "" {
+		return access.user
+	}
+	return access.host() + " " + access.userAgent
+}
+
+// bounds the active sessions (across shards). When full, the least
+// recently active tenth is closed.
+const sessionsMaxActive = 100000
+
+type session struct {
+	start, last time.Time
+	pages       uint
+	landing     string
+	exit        string
+}
+
+// closed sessions (of a minute)
+type sessionTally struct {
+	start    time.Time
+	closed   uint
+	length   time.Duration // sum of closed sessions
+	pages    uint          // sum of closed sessions
+	landings map[string]uint
+	exits    map[string]uint
+}
+
+func newSessionTally(start time.Time) *sessionTally {
+	return &sessionTally{start: start, landings: make(map[string]uint), exits: make(map[string]uint)}
+}
+
+func (p *sessionTally) merge(other *sessionTally) {
+	p.closed += other.closed
+	p.length += other.length
+	p.pages += other.pages
+	for route, cnt := range other.landings {
+		p.landings[route] += cnt
+	}
+	for route, cnt := range other.exits {
+		p.exits[route] += cnt
+	}
+}
+
+// the active sessions (of all visitors, or of a shard's, c.f. pipeline),
+// and the sessions started and closed since the last hand-off.
+type sessionSet struct {
+	timeout   time.Duration
+	maxActive int
+	active    map[string]*session
+	started   uint
+	tally     *sessionTally // landings and closed sessions
+}
+
+func newSessionSet(timeout time.Duration, maxActive int) *sessionSet {
+	return &sessionSet{
+		timeout:   timeout,
+		maxActive: maxActive,
+		active:    make(map[string]*session),
+		tally:     newSessionTally(time.Time{}),
+	}
+}
+
+func (p *sessionSet) Update(access *logEntry, now time.Time) {
+	if !isPageView(access) {
+		return
+	}
+	route := access.route()
+	key := sessionKey(access)
+	s, ok := p.active[key]
+	if ok && now.Sub(s.last) > p.timeout {
+		p.close(s)
+		ok = false
+	}
+	if !ok {
+		if len(p.active) >= p.maxActive {
+			p.evict(p.maxActive/10 + 1)
+		}
+		s = &session{start: now, landing: route}
+		p.active[key] = s
+		p.started++
+		p.tally.landings[route]++
+	}
+	s.last = now
+	s.exit = route
+	s.pages++
+}
+
+func (p *sessionSet) close(s *session) {
+	p.tally.closed++
+	p.tally.length += s.last.Sub(s.start)
+	p.tally.pages += s.pages
+	p.tally.exits[s.exit]++
+}
+
+// closes the sessions inactive for longer than the timeout
+func (p *sessionSet) expire(now time.Time) {
+	for key, s := range p.active {
+		if now.Sub(s.last) > p.timeout {
+			p.close(s)
+			delete(p.active, key)
+		}
+	}
+}
+
+// closes the n least recently active sessions
+func (p *sessionSet) evict(n int) {
+	keys := make([]string, 0, len(p.active))
+	for key := range p.active {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool { return p.active[keys[i]].last.Before(p.active[keys[j]].last) })
+	if n > len(keys) {
+		n = len(keys)
+	}
+	for _, key := range keys[:n] {
+		p.close(p.active[key])
+		delete(p.active, key)
+	}
+}
+
+// the changes of session sets since the last hand-off
+type sessionDelta struct {
+	active, started uint
+	tally           *sessionTally
+}
+
+func (p *sessionDelta) merge(other *sessionDelta) {
+	p.active += other.active
+	p.started += other.started
+	p.tally.merge(other.tally)
+}
+
+// expires inactive sessions and hands off the changes since the last
+// hand-off.
+func (p *sessionSet) handoff(now time.Time) *sessionDelta {
+	p.expire(now)
+	delta := &sessionDelta{uint(len(p.active)), p.started, p.tally}
+	p.started = 0
+	p.tally = newSessionTally(time.Time{})
+	return delta
+}
+
+// sessionTracker aggregates the session changes per snapshot into the
+// minutes of the last hour. Sessions are tracked by its own set, or with
+// the pipeline by the shards' sets (c.f. summarize).
+type sessionTracker struct {
+	sessions *sessionSet
+	rates    ewmaRates   // new sessions per second
+	minutes  *ringBuffer // <*sessionTally> : last hour
+	minute   *sessionTally
+}
+
+func newSessionTracker(timeout time.Duration) *sessionTracker {
+	return &sessionTracker{
+		sessions: newSessionSet(timeout, sessionsMaxActive),
+		minutes:  newRingBuffer(60),
+	}
+}
+
+func (p *sessionTracker) Update(access *logEntry, now time.Time) {
+	p.sessions.Update(access, now)
+}
+
+// returns the tally of the current minute, rolling over as necessary
+func (p *sessionTracker) tally(now time.Time) *sessionTally {
+	start := now.Truncate(time.Minute)
+	if p.minute != nil && !p.minute.start.Equal(start) {
+		p.minutes.add(p.minute)
+		p.minute = nil
+	}
+	if p.minute == nil {
+		p.minute = newSessionTally(start)
+	}
+	return p.minute
+}
+
+// ----------------------------------------------------------------------
+// summary
+
+type routeCount struct {
+	route string
+	cnt   uint
+}
+
+// the top routes reported
+const sessionTopRoutes = 20
+
+type sessionSummary struct {
+	active          uint
+	newPerMin       float64 // 1m EWMA
+	closed          uint    // in the last hour
+	avgLength       time.Duration
+	pagesPerSession float64
+	landings        []routeCount // descending
+	exits           []routeCount // descending
+}
+
+// summarizes the sessions as of now, with the changes since the last
+// summary of the given (sharded) sets, or else of the tracker's own set.
+// period is that of the snapshot (c.f. ewmaRates).
+func (p *sessionTracker) summarize(now time.Time, period time.Duration, sharded *sessionDelta) *sessionSummary {
+	delta := sharded
+	if delta == nil {
+		delta = p.sessions.handoff(now)
+	}
+	p.tally(now).merge(delta.tally)
+	p.rates.update(delta.started, period)
+
+	hour := newSessionTally(time.Time{})
+	hour.merge(p.tally(now))
+	for _, obj := range p.minutes.items() {
+		hour.merge(obj.(*sessionTally))
+	}
+	summary := &sessionSummary{
+		active:    delta.active,
+		newPerMin: p.rates[0] * 60,
+		closed:    hour.closed,
+		landings:  topRoutes(hour.landings, sessionTopRoutes),
+		exits:     topRoutes(hour.exits, sessionTopRoutes),
+	}
+	if hour.closed > 0 {
+		summary.avgLength = hour.length / time.Duration(hour.closed)
+		summary.pagesPerSession = float64(hour.pages) / float64(hour.closed)
+	}
+	return summary
+}
+
+func topRoutes(counts map[string]uint, n int) []routeCount {
+	top := make([]routeCount, 0, len(counts))
+	for route, cnt := range counts {
+		top = append(top, routeCount{route, cnt})
+	}
+	sort.Slice(top, func(i, j int) bool {
+		if top[i].cnt != top[j].cnt {
+			return top[i].cnt > top[j].cnt
+		}
+		return top[i].route < top[j].route
+	})
+	if len(top) > n {
+		top = top[:n]
+	}
+	return top
+}
@@ -0,0 +1,40 @@
+//    Copyright © 2016 Joubin Houshyar. All rights reserved.
+//
+//    This file is part of puppy.
+//
+//    puppy is free software: you can redistribute it and/or modify
+//    it under the terms of the GNU Affero General Public License as
+//    published by the Free Software Foundation, either version 3 of
+//    the License, or (at your option) any later version.
+//
+//    puppy is distributed in the hope that it will be useful,
+//    but WITHOUT ANY WARRANTY; without even the implied warranty of
+//    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//    GNU Affero General Public License for more details.
+//
+//    You should have received a copy of the GNU Affero General Public
+//    License along with puppy.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestSessionsEvictOldest(t *testing.T) {
+	p := newSessionTracker(30 * time.Minute)
+	now := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	for i, host := range []string{"10.0.0.1", "10.0.0.2", "10.0.0.3"} {
+		access := &logEntry{remoteHost: host, user: "-", uri: &url.URL{Path: "/"}}
+		p.Update(access, now.Add(time.Duration(i)*time.Second))
+	}
+	p.sessions.evict(2)
+	if _, ok := p.sessions.active["10.0.0.3 "]; !ok || len(p.sessions.active) != 1 {
+		t.Fatalf("expected only the most recent session active, got %v", p.sessions.active)
+	}
+	if summary := p.summarize(now.Add(time.Minute), time.Second, nil); summary.closed != 2 || summary.active != 1 {
+		t.Fatalf("expected 2 closed & 1 active, got %d & %d", summary.closed, summary.active)
+	}
+}
@@ -0,0 +1,365 @@
+//    Copyright © 2016 Joubin Houshyar. All rights reserved.
+//
+//    This file is part of puppy.
+//
+//    puppy is free software: you can redistribute it and/or modify
+//    it under the terms of the GNU Affero General Public License as
+//    published by the Free Software Foundation, either version 3 of
+//    the License, or (at your option) any later version.
+//
+//    puppy is distributed in the hope that it will be useful,
+//    but WITHOUT ANY WARRANTY; without even the implied warranty of
+//    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//    GNU Affero General Public License for more details.
+//
+//    You should have received a copy of the GNU Affero General Public
+//    License along with puppy.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// General note:
+// Each route template has an objective (c.f. conf.sloFile), else the
+// default objective per config:
+//
+//  - Apdex: requests within T are satisfied, within 4T tolerating, and
+//    frustrated otherwise, with server errors (5xx) always frustrated. The
+//    score is (satisfied + tolerating/2) / timed requests, so requires a
+//    duration field (c.f. conf.durationField).
+//  - availability: the ratio of requests that are not server errors,
+//    with the error budget being the allowed ratio of errors (1-target)
+//    over the rolling window (c.f. conf.sloWindowMin).
+//
+// Scores are reported for the snapshot and for the rolling window, which
+// is kept as per minute tallies by route, with a running total of the
+// window (adding each snapshot, and subtracting each evicted minute), and
+// are unscoped.
+//
+// Routes with an objective are always tracked. Otherwise, as the route
+// cardinality is unbounded (e.g. slugs), only the top routes of each
+// snapshot are admitted to the window, up to sloMaxRoutes, and a route is
+// tracked until it has no requests in the window. The window of a route
+// thus starts at its admission.
+
+// the top routes of a snapshot admitted to the window, and the bound on
+// tracked routes (bar those with an objective)
+const (
+	sloTopRoutes = 20
+	sloMaxRoutes = 200
+)
+
+type sloObjective struct {
+	apdexT   time.Duration
+	apdexMin float64 // alert threshold of the window apdex, 0 for none
+	target   float64 // availability, e.g. 0.999
+}
+
+type sloObjectives struct {
+	routes   map[string]sloObjective
+	fallback sloObjective
+}
+
+// the objectives of routes. Set on startup.
+var objectives *sloObjectives
+
+// loads the objectives of routes from the named file, one per line, as
+//
+//    route apdex-T [apdex-min [availability%]]
+//
+// e.g. '/api/users/:id 300ms 0.9 99.95'. Fields may be '-' for the
+// fallback. Blank lines and '#' comments are ignored. An empty fname
+// has no route objectives.
+func loadSloObjectives(fname string, fallback sloObjective) (*sloObjectives, error) {
+	p := &sloObjectives{make(map[string]sloObjective), fallback}
+	if fname == "" {
+		return p, nil
+	}
+	file, e := os.Open(fname)
+	if e != nil {
+		return nil, fmt.Errorf("err - loadSloObjectives - %s", e.Error())
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		objective, e := parseSloObjective(strings.Fields(line)[1:], fallback)
+		if e != nil {
+			return nil, fmt.Errorf("err - loadSloObjectives - %s:%d - %s", fname, n, e.Error())
+		}
+		p.routes[strings.Fields(line)[0]] = objective
+	}
+	return p, scanner.Err()
+}
+
+func parseSloObjective(fields []string, fallback sloObjective) (objective sloObjective, e error) {
+	objective = fallback
+	if len(fields) == 0 || len(fields) > 3 {
+		return objective, fmt.Errorf("expected: route apdex-T [apdex-min [availability%%]]")
+	}
+	if fields[0] != "-" {
+		if objective.apdexT, e = time.ParseDuration(fields[0]); e != nil || objective.apdexT <= 0 {
+			return objective, fmt.Errorf("invalid apdex-T %q", fields[0])
+		}
+	}
+	if len(fields) > 1 && fields[1] != "-" {
+		if objective.apdexMin, e = strconv.ParseFloat(fields[1], 64); e != nil || objective.apdexMin < 0 || objective.apdexMin > 1 {
+			return objective, fmt.Errorf("invalid apdex-min %q", fields[1])
+		}
+	}
+	if len(fields) > 2 && fields[2] != "-" {
+		target, e := strconv.ParseFloat(strings.TrimSuffix(fields[2], "%"), 64)
+		if e != nil || target <= 0 || target >= 100 {
+			return objective, fmt.Errorf("invalid availability %q", fields[2])
+		}
+		objective.target = target / 100
+	}
+	return objective, nil
+}
+
+// returns true if the route has its own objective
+func (p *sloObjectives) has(route string) bool {
+	_, ok := p.routes[route]
+	return ok
+}
+
+func (p *sloObjectives) of(route string) sloObjective {
+	if objective, ok := p.routes[route]; ok {
+		return objective
+	}
+	return p.fallback
+}
+
+// ----------------------------------------------------------------------
+// tallies
+
+type sloTally struct {
+	total, good           uint // good is not a server error
+	timed                 uint
+	satisfied, tolerating uint
+}
+
+func (p *sloTally) update(access *logEntry, objective sloObjective) {
+	p.total++
+	failed := statusClass(access.status) == 5
+	if !failed {
+		p.good++
+	}
+	if !access.timed {
+		return
+	}
+	p.timed++
+	switch {
+	case failed:
+	case access.duration <= objective.apdexT:
+		p.satisfied++
+	case access.duration <= 4*objective.apdexT:
+		p.tolerating++
+	}
+}
+
+func (p *sloTally) merge(other *sloTally) {
+	p.total += other.total
+	p.good += other.good
+	p.timed += other.timed
+	p.satisfied += other.satisfied
+	p.tolerating += other.tolerating
+}
+
+// complement of merge, other must have been merged
+func (p *sloTally) subtract(other *sloTally) {
+	p.total -= other.total
+	p.good -= other.good
+	p.timed -= other.timed
+	p.satisfied -= other.satisfied
+	p.tolerating -= other.tolerating
+}
+
+// ok is false if there are no timed requests
+func (p *sloTally) apdex() (score float64, ok bool) {
+	if p.timed == 0 {
+		return 0, false
+	}
+	return (float64(p.satisfied) + float64(p.tolerating)/2) / float64(p.timed), true
+}
+
+// 1 if there are no requests
+func (p *sloTally) availability() float64 {
+	if p.total == 0 {
+		return 1
+	}
+	return float64(p.good) / float64(p.total)
+}
+
+// tallies by route
+type sloTallies map[string]*sloTally
+
+func (p sloTallies) tally(route string) *sloTally {
+	tally, ok := p[route]
+	if !ok {
+		tally = &sloTally{}
+		p[route] = tally
+	}
+	return tally
+}
+
+// tallies the access by its route
+func (p sloTallies) Update(access *logEntry) {
+	route := access.route()
+	p.tally(route).update(access, objectives.of(route))
+}
+
+func (p sloTallies) merge(other sloTallies) {
+	for route, tally := range other {
+		p.tally(route).merge(tally)
+	}
+}
+
+type sloMinute struct {
+	start  time.Time
+	routes sloTallies
+}
+
+// ----------------------------------------------------------------------
+// tracker
+
+type sloTracker struct {
+	snapshot sloTallies  // in-progress tallies of current snapshot
+	minute   *sloMinute  // current minute (of completed snapshots)
+	minutes  *ringBuffer // <*sloMinute> : rolling window
+	window   sloTallies  // running total of minute and minutes
+}
+
+func newSloTracker(windowMin uint) *sloTracker {
+	if windowMin < 2 {
+		windowMin = 2
+	}
+	return &sloTracker{
+		snapshot: make(sloTallies),
+		minutes:  newRingBuffer(windowMin - 1),
+		window:   make(sloTallies),
+	}
+}
+
+func (p *sloTracker) Update(access *logEntry) {
+	p.snapshot.Update(access)
+}
+
+// adds the tallies (of a shard, c.f. pipeline) to the snapshot
+func (p *sloTracker) merge(tallies sloTallies) {
+	p.snapshot.merge(tallies)
+}
+
+// the scores of a route
+type sloStatus struct {
+	route     string
+	objective sloObjective
+	current   sloTally // of the snapshot
+	window    sloTally // of the rolling window
+}
+
+// remaining error budget of the window, as a ratio of the allowed errors.
+// Negative once overspent.
+func (p *sloStatus) budget() float64 {
+	allowed := (1 - p.objective.target) * float64(p.window.total)
+	if allowed == 0 {
+		return 1
+	}
+	return 1 - float64(p.window.total-p.window.good)/allowed
+}
+
+// returns a description of the breached objective, or "" if none
+func (p *sloStatus) breach() string {
+	if p.budget() <= 0 {
+		return fmt.Sprintf("availability %.2f%% < %.2f%% (error budget exhausted)",
+			p.window.availability()*100, p.objective.target*100)
+	}
+	if apdex, ok := p.window.apdex(); ok && apdex < p.objective.apdexMin {
+		return fmt.Sprintf("apdex %.2f < %.2f", apdex, p.objective.apdexMin)
+	}
+	return ""
+}
+
+// completes the snapshot (of the period ending at ts) and returns the
+// status of the routes of the window, least remaining budget first.
+func (p *sloTracker) summarize(ts time.Time) []sloStatus {
+	start := ts.Truncate(time.Minute)
+	if p.minute != nil && !p.minute.start.Equal(start) {
+		if items := p.minutes.items(); uint(len(items)) == p.minutes.cap { /* evicted on add */
+			p.evict(items[len(items)-1].(*sloMinute))
+		}
+		p.minutes.add(p.minute)
+		p.minute = nil
+	}
+	if p.minute == nil {
+		p.minute = &sloMinute{start, make(sloTallies)}
+	}
+	p.admit(p.snapshot)
+
+	statuses := make([]sloStatus, 0, len(p.window))
+	for route, tally := range p.window {
+		status := sloStatus{route: route, objective: objectives.of(route), window: *tally}
+		if current, ok := p.snapshot[route]; ok {
+			status.current = *current
+		}
+		statuses = append(statuses, status)
+	}
+	sort.Slice(statuses, func(i, j int) bool {
+		if bi, bj := statuses[i].budget(), statuses[j].budget(); bi != bj {
+			return bi < bj
+		}
+		return statuses[i].route < statuses[j].route
+	})
+	p.snapshot = make(sloTallies)
+	return statuses
+}
+
+// adds the tallies of the tracked routes of the snapshot, and of its top
+// routes (as room allows), to the current minute and the window.
+func (p *sloTracker) admit(snapshot sloTallies) {
+	routes := make([]string, 0, len(snapshot))
+	for route := range snapshot {
+		routes = append(routes, route)
+	}
+	sort.Slice(routes, func(i, j int) bool {
+		if ti, tj := snapshot[routes[i]].total, snapshot[routes[j]].total; ti != tj {
+			return ti > tj
+		}
+		return routes[i] < routes[j]
+	})
+	for n, route := range routes {
+		_, tracked := p.window[route]
+		if !tracked && !objectives.has(route) && (n >= sloTopRoutes || len(p.window) >= sloMaxRoutes) {
+			continue
+		}
+		p.minute.routes.tally(route).merge(snapshot[route])
+		p.window.tally(route).merge(snapshot[route])
+	}
+}
+
+// subtracts the minute from the window. Routes with no requests left in
+// the window are no longer tracked.
+func (p *sloTracker) evict(minute *sloMinute) {
+	for route, tally := range minute.routes {
+		window, ok := p.window[route]
+		if !ok {
+			continue
+		}
+		window.subtract(tally)
+		if window.total == 0 {
+			delete(p.window, route)
+		}
+	}
+}
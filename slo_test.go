@@ -0,0 +1,69 @@
+//    Copyright © 2016 Joubin Houshyar. All rights reserved.
+//
+//    This file is part of puppy.
+//
+//    puppy is free software: you can redistribute it and/or modify
+//    it under the terms of the GNU Affero General Public License as
+//    published by the Free Software Foundation, either version 3 of
+//    the License, or (at your option) any later version.
+//
+//    puppy is distributed in the hope that it will be useful,
+//    but WITHOUT ANY WARRANTY; without even the implied warranty of
+//    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//    GNU Affero General Public License for more details.
+//
+//    You should have received a copy of the GNU Affero General Public
+//    License along with puppy.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestSloWindow(t *testing.T) {
+	defer func(o *sloObjectives) { objectives = o }(objectives)
+	objectives, _ = loadSloObjectives("", sloObjective{apdexT: 500 * time.Millisecond, target: 0.99})
+	objectives.routes["/slow"] = sloObjective{apdexT: time.Second, target: 0.9}
+
+	access := func(path string, status uint) *logEntry {
+		return &logEntry{uri: &url.URL{Path: path}, status: status}
+	}
+	p := newSloTracker(3) /* current minute + 2 */
+	ts := time.Date(2026, 10, 18, 12, 0, 30, 0, time.UTC)
+	for minute := 0; minute < 5; minute++ {
+		for i := 0; i < sloMaxRoutes*2; i++ { /* many one-off routes */
+			p.Update(access(fmt.Sprintf("/page-%d-%d", minute, i), 200))
+		}
+		for i := 0; i < 100; i++ {
+			p.Update(access("/top", 200))
+		}
+		p.Update(access("/slow", 500))
+		statuses := p.summarize(ts.Add(time.Duration(minute) * time.Minute))
+
+		if len(p.window) > sloMaxRoutes+1 {
+			t.Fatalf("minute %d - tracking %d routes", minute, len(p.window))
+		}
+		window := make(map[string]sloTally)
+		for _, status := range statuses {
+			window[status.route] = status.window
+		}
+		/* running totals as of the window (of up to 3 minutes) */
+		minutes := uint(minute + 1)
+		if minutes > 3 {
+			minutes = 3
+		}
+		if top := window["/top"]; top.total != 100*minutes || top.good != 100*minutes {
+			t.Errorf("minute %d - /top window %+v, expected %d", minute, top, 100*minutes)
+		}
+		if slow := window["/slow"]; slow.total != minutes || slow.good != 0 {
+			t.Errorf("minute %d - /slow window %+v, expected %d", minute, slow, minutes)
+		}
+		if statuses[0].route != "/slow" || statuses[0].breach() == "" {
+			t.Errorf("minute %d - expected /slow breach first, got %s", minute, statuses[0].route)
+		}
+	}
+}
@@ -40,45 +40,252 @@ type AccessMetrics interface {
 // ---------------------------------------------------------------------
 // access info
 
+// HTTP methods per RFC 9110 (and PATCH per RFC 5789). Methods are case
+// sensitive, and anything else (extension methods and garbage alike) is
+// counted as methodOther.
+type httpMethod byte
+
+const (
+	methodGet httpMethod = iota
+	methodHead
+	methodPost
+	methodPut
+	methodDelete
+	methodConnect
+	methodOptions
+	methodTrace
+	methodPatch
+	methodOther
+	methodCount // not a method
+)
+
+var methodNames = [methodCount]string{
+	"GET", "HEAD", "POST", "PUT", "DELETE", "CONNECT", "OPTIONS", "TRACE", "PATCH", "OTHER",
+}
+
+func (m httpMethod) String() string { return methodNames[m] }
+
+func parseMethod(s string) httpMethod {
+	for m, name := range methodNames[:methodOther] {
+		if s == name {
+			return httpMethod(m)
+		}
+	}
+	return methodOther
+}
+
+// Counters are kept per key of every table, so the status codes and the
+// latency histogram, which are a few KB, are opt-in: codes are only
+// counted by summary counters (c.f. newSummaryCounter), and latency only
+// where recorded (c.f. recordLatency), i.e. by summaries and the keys of
+// timed dimensions.
 type accessCounter struct {
-	total, gets, puts, posts, dels, other uint
+	total   uint
+	methods [methodCount]uint
+	bots    *accessCounter // the bot accesses; nil if none (c.f. userAgent.isBot)
+	latency *histogram     // nil if no latency recorded
+	classes [6]uint        // by status class, [0] for invalid
+	codes   map[uint]uint  // by status; nil if not counted
+	bytes   uint64         // bytes served
 }
+
+// returns a counter that counts status codes as well
+func newSummaryCounter() *accessCounter {
+	return &accessCounter{codes: make(map[uint]uint)}
+}
+
 type accessRatio struct {
-	gets, puts, posts, dels, other float64
+	methods [methodCount]float64
+	bots    float64
+	classes [6]float64
+}
+
+// status classes 1xx-5xx, with 0 for invalid (or missing) status
+func statusClass(status uint) uint {
+	if class := status / 100; class >= 1 && class <= 5 {
+		return class
+	}
+	return 0
 }
 
 func (p *accessCounter) ratios() *accessRatio {
 	ratios := &accessRatio{}
 	if p.total > 0 {
 		n := float64(p.total)
-		ratios.gets = float64(p.gets) / n
-		ratios.puts = float64(p.puts) / n
-		ratios.dels = float64(p.dels) / n
-		ratios.posts = float64(p.posts) / n
-		ratios.other = float64(p.other) / n
+		for i, cnt := range p.methods {
+			ratios.methods[i] = float64(cnt) / n
+		}
+		ratios.bots = float64(p.filtered(botsOnly)) / n
+		for i, cnt := range p.classes {
+			ratios.classes[i] = float64(cnt) / n
+		}
 	}
 	return ratios
 }
+
+// server errors (5xx) ratio
+func (p *accessCounter) errorRate() float64 {
+	if p.total == 0 {
+		return 0
+	}
+	return float64(p.classes[5]) / float64(p.total)
+}
 func (p *accessCounter) Update(access *logEntry) error {
 	if access == nil {
 		return fmt.Errorf("err - accessCounter.update - assert - access is nil")
 	}
-	switch access.method {
-	case "GET":
-		p.gets++
-	case "PUT":
-		p.puts++
-	case "POST":
-		p.posts++
-	case "DEL":
-		p.dels++
-	default:
-		p.other++
+	p.count(access)
+	if access.classify().isBot() {
+		p.botCounter().count(access)
 	}
-	p.total++
 	return nil
 }
 
+// counts the access, regardless of agent
+func (p *accessCounter) count(access *logEntry) {
+	p.methods[parseMethod(access.method)]++
+	p.classes[statusClass(access.status)]++
+	if p.codes != nil {
+		p.codes[access.status]++
+	}
+	p.bytes += uint64(access.bytes)
+	p.total++
+}
+
+// returns the counter of the bot accesses, created if need be, which
+// counts codes if the receiver does.
+func (p *accessCounter) botCounter() *accessCounter {
+	if p.bots == nil {
+		p.bots = &accessCounter{}
+		if p.codes != nil {
+			p.bots.codes = make(map[uint]uint)
+		}
+	}
+	return p.bots
+}
+
+// records the latency of the (counted) access, if timed
+func (p *accessCounter) recordLatency(access *logEntry) {
+	if !access.timed {
+		return
+	}
+	if p.latency == nil {
+		p.latency = newHistogram()
+	}
+	p.latency.record(access.duration)
+	if p.bots != nil && access.classify().isBot() {
+		p.bots.recordLatency(access)
+	}
+}
+
+// returns a copy of the counts, sans agents, latency and codes, e.g. for
+// rollups which only need the totals.
+func (p *accessCounter) counts() *accessCounter {
+	return &accessCounter{total: p.total, methods: p.methods, classes: p.classes, bytes: p.bytes}
+}
+
+// average response size
+func (p *accessCounter) avgBytes() uint64 {
+	if p.total == 0 {
+		return 0
+	}
+	return p.bytes / uint64(p.total)
+}
+
+// adds the counts of other to the receiver
+func (p *accessCounter) merge(other *accessCounter) {
+	for i, cnt := range other.methods {
+		p.methods[i] += cnt
+	}
+	if other.bots != nil {
+		p.botCounter().merge(other.bots)
+	}
+	p.total += other.total
+	p.bytes += other.bytes
+	if other.latency != nil {
+		if p.latency == nil {
+			p.latency = newHistogram()
+		}
+		p.latency.merge(other.latency)
+	}
+	for i, cnt := range other.classes {
+		p.classes[i] += cnt
+	}
+	if p.codes != nil { /* if counted, c.f. newSummaryCounter */
+		for code, cnt := range other.codes {
+			p.codes[code] += cnt
+		}
+	}
+}
+
+// returns the count of the counter per the agent filter.
+func (p *accessCounter) filtered(filter agentFilter) uint {
+	bots := uint(0)
+	if p.bots != nil {
+		bots = p.bots.total
+	}
+	switch filter {
+	case humansOnly:
+		return p.total - bots
+	case botsOnly:
+		return bots
+	}
+	return p.total
+}
+
+// returns the bytes served of the counter per the agent filter.
+func (p *accessCounter) filteredBytes(filter agentFilter) uint64 {
+	bots := uint64(0)
+	if p.bots != nil {
+		bots = p.bots.bytes
+	}
+	switch filter {
+	case humansOnly:
+		return p.bytes - bots
+	case botsOnly:
+		return bots
+	}
+	return p.bytes
+}
+
+// returns the counter of the accesses per the agent filter, i.e. the
+// counter itself, its bots, or the difference. The max latency of humans
+// is that of all agents.
+func (p *accessCounter) view(filter agentFilter) *accessCounter {
+	switch {
+	case filter == allAgents:
+		return p
+	case filter == botsOnly && p.bots == nil:
+		return &accessCounter{}
+	case filter == botsOnly:
+		return p.bots
+	case p.bots == nil:
+		return p
+	}
+	humans := &accessCounter{
+		total:   p.total - p.bots.total,
+		methods: p.methods,
+		classes: p.classes,
+		bytes:   p.bytes - p.bots.bytes,
+		latency: p.latency.without(p.bots.latency),
+	}
+	for i, cnt := range p.bots.methods {
+		humans.methods[i] -= cnt
+	}
+	for i, cnt := range p.bots.classes {
+		humans.classes[i] -= cnt
+	}
+	if p.codes != nil {
+		humans.codes = make(map[uint]uint, len(p.codes))
+		for code, cnt := range p.codes {
+			if cnt -= p.bots.codes[code]; cnt > 0 {
+				humans.codes[code] = cnt
+			}
+		}
+	}
+	return humans
+}
+
 type namedCounter struct {
 	name    string
 	counter *accessCounter
@@ -89,85 +296,148 @@ func (a ByTotal) Len() int           { return len(a) }
 func (a ByTotal) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
 func (a ByTotal) Less(i, j int) bool { return a[i].counter.total < a[j].counter.total }
 
+// returns the (at most) n top entries, descending, but otherKey. Entries
+// sorted ascending (c.f. accessStats.inOrder) are picked from the end,
+// others in a single pass rather than sorting them all.
+func topEntries(entries []namedCounter, n int) []namedCounter {
+	if n <= 0 {
+		return nil
+	}
+	top := make([]namedCounter, 0, n+1)
+	if sort.IsSorted(ByTotal(entries)) {
+		for i := len(entries) - 1; i >= 0 && len(top) < n; i-- {
+			if entries[i].name != otherKey {
+				top = append(top, entries[i])
+			}
+		}
+		return top
+	}
+	for _, entry := range entries {
+		if entry.name == otherKey || (len(top) == n && entry.counter.total <= top[n-1].counter.total) {
+			continue
+		}
+		i := sort.Search(len(top), func(i int) bool { return top[i].counter.total < entry.counter.total })
+		top = append(top, namedCounter{})
+		copy(top[i+1:], top[i:])
+		top[i] = entry
+		if len(top) > n {
+			top = top[:n]
+		}
+	}
+	return top
+}
+
 // ---------------------------------------------------------------------
 // measures
 
-// meaures captures distinct data views on access information.
+// meaures captures distinct data views on access information, with a
+// counter table per dimension (c.f. dimensions).
 type measures struct {
-	resources map[string]*accessCounter
-	users     map[string]*accessCounter
-	hosts     map[string]*accessCounter
+	summary  *accessCounter // all access
+	tables   map[string]counterTable
+	sections *sectionTree
+	uniques  *uniqueSketches
 }
 
 func newMeasures() *measures {
 	p := &measures{
-		make(map[string]*accessCounter),
-		make(map[string]*accessCounter),
-		make(map[string]*accessCounter),
+		summary:  newSummaryCounter(),
+		tables:   make(map[string]counterTable, len(dimensions)),
+		sections: newSectionTree(conf.sectionDepth, conf.maxKeys),
+		uniques:  newUniqueSketches(),
+	}
+	for _, dim := range dimensions {
+		p.tables[dim.name] = newCounterTable(dim.bounded)
 	}
 	return p
 }
+
+// high cardinality (bounded) tables are optionally top-k (c.f. topKTable)
+// and the others optionally capped (c.f. cappedTable)
+func newCounterTable(bounded bool) counterTable {
+	switch {
+	case bounded && conf.topK > 0:
+		return newTopKTable(int(conf.topK))
+	case conf.maxKeys > 0:
+		return newCappedTable(int(conf.maxKeys))
+	}
+	return newExactTable()
+}
+
+// returns the max keys of the tables of newCounterTable, or 0 if unbounded
+func tableCap(bounded bool) int {
+	switch {
+	case bounded && conf.topK > 0:
+		return int(conf.topK)
+	case conf.maxKeys > 0:
+		return int(conf.maxKeys)
+	}
+	return 0
+}
+
 func (p *measures) Update(access *logEntry) error {
 	if access == nil {
 		return fmt.Errorf("err - measures.update - assert - access is nil")
 	}
-	keys := []string{access.section(), access.remoteHost, access.user}
-	maps := []map[string]*accessCounter{p.resources, p.hosts, p.users}
-	for i, key := range keys {
-		info, ok := (maps[i])[key]
-		if !ok {
-			info = &accessCounter{}
-			(maps[i])[key] = info
+	p.summary.Update(access)
+	p.summary.recordLatency(access)
+	p.uniques.Update(access)
+	for _, dim := range dimensions {
+		table := p.tables[dim.name]
+		for _, key := range dim.keys(access) {
+			counter := table.update(key, access)
+			if dim.timed {
+				counter.recordLatency(access)
+			}
 		}
-		info.Update(access) // ok to ignore error here
 	}
-	return nil
+	return p.sections.Update(access)
+}
+
+// adds the measures of other to the receiver (c.f. pipeline)
+func (p *measures) merge(other *measures) {
+	p.summary.merge(other.summary)
+	for name, table := range p.tables {
+		table.merge(other.tables[name])
+	}
+	p.sections.merge(other.sections)
+	p.uniques.merge(other.uniques)
 }
 
 // used to compute elements for overall traffic metrics
 func (p *measures) summarize() *accessCounter {
-	summary := &accessCounter{}
-	for _, entry := range p.resources {
-		summary.gets += entry.gets
-		summary.puts += entry.puts
-		summary.posts += entry.posts
-		summary.dels += entry.dels
-		summary.other += entry.other
-		summary.total += entry.total
-	}
-	return summary
+	return p.summary
 }
 
 // panics
 func (p *measures) statsBy(attribute string) *accessStats {
-	var data map[string]*accessCounter
+	data, ok := p.tables[attribute]
+	if !ok {
+		panic(fmt.Sprintf("bug - measures.statsBy - unknown attribute %s", attribute))
+	}
+	stats := newAccessStats(data)
+	if dim := findDimension(attribute); dim != nil {
+		stats.timed = dim.timed
+	}
+	return stats
+}
+
+// returns the stats of the table, ordered by count
+func newAccessStats(data counterTable) *accessStats {
 	//	var column []namedCounter
 	var stats accessStats
 
-	switch attribute {
-	case "user":
-		data = p.users
-	case "host":
-		data = p.hosts
-	case "resource":
-		data = p.resources
-	default:
-		panic(fmt.Sprintf("bug - measures.statsBy - unknown attribute %s", attribute))
-	}
-	stats.total = uint(len(data))
-	stats.inOrder = make([]namedCounter, stats.total) // make it regardless of len
+	stats.k, stats.maxErr = data.errorBound()
+	stats.folded, stats.foldedKeys = data.overflow()
+	stats.inOrder = data.entries() // make it regardless of len
+	stats.total = uint(len(stats.inOrder))
 	if stats.total == 0 {
 		return &stats
 	}
 
-	i := 0
-	for key, counter := range data {
-		stats.inOrder[i] = namedCounter{key, counter}
-		i++
-	}
 	sort.Sort(ByTotal(stats.inOrder))
-	stats.top = stats.inOrder[len(data)-1].name
-	stats.topRatio = float64(stats.inOrder[len(data)-1].counter.total) / float64(stats.total)
+	stats.top = stats.inOrder[stats.total-1].name
+	stats.topRatio = float64(stats.inOrder[stats.total-1].counter.total) / float64(stats.total)
 
 	return &stats
 }
@@ -178,30 +448,75 @@ func (p *measures) statsBy(attribute string) *accessStats {
 // metrics capture the overall high level view on the data collected.
 // On every snapshot period, the wip is finalized as 'snapshot', with
 // associated addition of a new traffic element.
+//
+// Views may be scoped to a single vhost (c.f. setScope), in which case the
+// statistic is computed from the scoped measures. The traffic data (and
+// thus alerts) always remain unscoped.
 type metrics struct {
 	traffic     *ringBuffer // <*accessCounter> : accumulated periodic data
 	snapshot    *measures   // immutable snapshot of last period's measure
 	snapshot_ts time.Time   // timestamp of snapshot update
 	wip         *measures   // in-progress measures of current period
+	scope       string      // vhost, "" if unscoped
+	scopedWip   *measures   // in-progress measures of scope; nil if unscoped
+	uniques     *uniqueWindows
+	rollups     *rollups            // c.f. rollupTiers
+	recent      *ringBuffer         // <*logEntry> : c.f. conf.pivotWindow; nil if off
+	rates       ewmaRates           // site request rates
+	keyRates    map[string]keyRates // (scoped) request rates per dimension
+	sessions    *sessionTracker     // nil if off, c.f. conf.sessionTimeoutMin
+	slos        *sloTracker
+	totals      *totals   // since start or reset
+	pipeline    *pipeline // nil if inline, c.f. conf.workers
+	movers      *moversHistory
 }
 
 type accessStats struct {
-	total    uint
-	top      string
-	topRatio float64
-	inOrder  []namedCounter
+	total      uint // distinct keys (monitored keys if bounded)
+	top        string
+	topRatio   float64
+	inOrder    []namedCounter
+	k          int                  // 0 if exact, c.f. counterTable.errorBound
+	maxErr     uint                 // max over-estimation of counts if bounded
+	timed      bool                 // latency recorded per key, c.f. dimension.timed
+	rates      map[string]ewmaRates // by key; nil if not tracked
+	folded     uint                 // accesses folded into otherKey if capped
+	foldedKeys uint64               // estimated distinct keys folded
 }
 
-// REVU: for an extensible variant of puppy, use a map[key]value.
 type statistic struct {
+	scope string // vhost, "" if unscoped
+
 	// access counts and ratio breakdown by access method
 	accessCnt   *accessCounter
 	accessRatio *accessRatio
+	latency     *latencySummary // nil if no timed access
+	period      time.Duration   // since the prior snapshot
+	rates       ewmaRates       // (unscoped) request rates
+
+	// stats by dimension (c.f. by)
+	byDimension map[string]*accessStats
+
+	// path hierarchy (c.f. conf.sectionDepth)
+	sections *sectionTree
+
+	// (unscoped) unique count estimates per uniqueWindowMins
+	uniques [][uniqueCount]uint64
 
-	// stats for various access attributes
-	byResource *accessStats
-	byUser     *accessStats
-	byHost     *accessStats
+	// (unscoped) traffic comparisons per rollupComparisons
+	comparisons []rollupComparison
+
+	// (unscoped) deviations from the seasonal baseline; nil while learning
+	anomalies []anomaly
+
+	// (unscoped) visitor sessions; nil if not tracked
+	sessions *sessionSummary
+
+	// (unscoped) SLO status by route, least remaining budget first
+	slos []sloStatus
+
+	// movers by reference and attribute (c.f. moversAttributes)
+	movers [moversReferences]map[string][]mover
 }
 
 // limit rsolution to a reasonable 2^16 - 1.
@@ -213,47 +528,178 @@ func newMetrics(resolution uint16) (*metrics, error) {
 	s.traffic = newRingBuffer(uint(resolution))
 	s.snapshot = newMeasures()
 	s.wip = newMeasures()
+	s.uniques = newUniqueWindows(60 / conf.statPeriodSec)
+	s.rollups = newRollups()
+	s.keyRates = make(map[string]keyRates)
+	s.slos = newSloTracker(conf.sloWindowMin)
+	s.totals = newTotals(time.Now())
+	s.movers = newMoversHistory(conf.moversWindowMin)
+	if conf.workers > 1 {
+		s.pipeline = newPipeline(conf.workers, s.totals.since)
+	}
+	if conf.sessionTimeoutMin > 0 {
+		s.sessions = newSessionTracker(time.Duration(conf.sessionTimeoutMin) * time.Minute)
+	}
+	if conf.pivotWindow > 0 {
+		s.recent = newRingBuffer(conf.pivotWindow)
+	}
 
 	return s, nil
 }
 
+// Update measures and tallies the access (unless done by the pipeline
+// shards) and tracks it in the remaining (unsharded) state.
 func (p *metrics) Update(access *logEntry) error {
 	if access == nil {
 		return fmt.Errorf("err - metrics.update - assert - access is nil")
 	}
-	return p.wip.Update(access)
+	if p.recent != nil {
+		p.recent.add(access)
+	}
+	if p.pipeline != nil {
+		return nil
+	}
+	if p.scopedWip != nil && access.vhost == p.scope {
+		p.scopedWip.Update(access)
+	}
+	if e := p.wip.Update(access); e != nil {
+		return e
+	}
+	if p.sessions != nil {
+		p.sessions.Update(access, time.Now())
+	}
+	p.slos.Update(access)
+	return p.totals.Update(access)
+}
+
+// restarts the totals
+func (p *metrics) resetTotals() {
+	p.totals = newTotals(time.Now())
+	if p.pipeline != nil {
+		p.pipeline.resetTotals(p.totals.since)
+	}
+}
+
+// scopes the statistic to the given vhost, effective immediately, so the
+// first scoped snapshot is partial. "" clears the scope.
+func (p *metrics) setScope(vhost string) {
+	p.scope = vhost
+	p.scopedWip = nil
+	p.keyRates = make(map[string]keyRates)
+	p.movers = newMoversHistory(conf.moversWindowMin)
+	if vhost != "" {
+		p.scopedWip = newMeasures()
+	}
+	if p.pipeline != nil {
+		p.pipeline.setScope(vhost)
+	}
 }
 
 // called periodically to take snapshot of running measures and
 // update the overall traffic metrics. this function will panic on detected
 // bugs.
 //
-// REVU: for concurrent version, async hand-off in conjunction with addition of
-//       a serialization point (e.g. mutext) would address requirements for
-//       a high performance version. It is not strictly necessary to return a
-//       future in that case but obviously no longer returning a statistic ref.
-//
-func (p *metrics) takeSnapshot() *statistic {
+// With the pipeline (c.f. conf.workers) the snapshot is of the merged
+// hand-off of the shards' wip (c.f. pipeline.swap), which is nil if
+// inline.
+func (p *metrics) takeSnapshot(sharded *shardWip) *statistic {
+
+	// hand-off of the shards' wip, as of the swap. The totals are the
+	// shards' running totals, unless of before a reset (c.f. resetTotals).
+	snapshot_ts := time.Now()
+	if sharded != nil {
+		snapshot_ts = sharded.at
+		p.wip = sharded.wip
+		if sharded.scope == p.scope { /* else rescoped since, c.f. setScope */
+			p.scopedWip = sharded.scopedWip
+		}
+		p.slos.merge(sharded.slos)
+		if sharded.totals.since.Equal(p.totals.since) {
+			p.totals = sharded.totals
+		}
+	}
 
 	// update metrics with collected data in wip
+	prior_ts := p.snapshot_ts
 	p.snapshot = p.wip
-	p.snapshot_ts = time.Now()
+	p.snapshot_ts = snapshot_ts
 	p.wip = newMeasures()
 	accessCnt := p.snapshot.summarize()
 	p.traffic.add(accessCnt)
+	p.uniques.add(p.snapshot.uniques)
+	if prior_ts.IsZero() {
+		prior_ts = p.snapshot_ts.Add(-time.Second * time.Duration(conf.statPeriodSec))
+	}
+	period := p.snapshot_ts.Sub(prior_ts)
+	p.rates.update(accessCnt.total, period)
+
+	snapshotCnt := accessCnt /* unscoped */
+	measured := p.snapshot
+	if p.scopedWip != nil {
+		measured = p.scopedWip
+		p.scopedWip = newMeasures()
+		accessCnt = measured.summarize()
+	}
 
 	// compute the stats for the snapshot
 	//
 	// in the simple case this boils down to sorting the
 	// access info  uri and other attributes (in this case user and host).
 	stats := &statistic{}
+	stats.scope = p.scope
 	stats.accessCnt = accessCnt
 	stats.accessRatio = accessCnt.ratios()
+	stats.latency = accessCnt.latency.summary()
+	stats.period = period
+	stats.rates = p.rates
 
-	//	stats.byResource.total = uint(len(p.snapshot.resources))
-	stats.byResource = p.snapshot.statsBy("resource")
-	stats.byUser = p.snapshot.statsBy("user")
-	stats.byHost = p.snapshot.statsBy("host")
+	stats.byDimension = make(map[string]*accessStats, len(dimensions))
+	for _, dim := range dimensions {
+		stats.byDimension[dim.name] = measured.statsBy(dim.name)
+	}
+	stats.byDimension["vhost"] = p.snapshot.statsBy("vhost") // unscoped, c.f. setScope
+
+	// the baselines are unscoped as well, so if scoped the top routes are
+	// picked from the snapshot rather than sorting it all over again
+	var topRoutes []namedCounter /* descending */
+	if measured == p.snapshot {
+		topRoutes = topEntries(stats.byDimension["resource"].inOrder, baselineTopRoutes)
+	} else {
+		topRoutes = topEntries(p.snapshot.tables["resource"].entries(), baselineTopRoutes)
+	}
+	routeCnts := make(map[string]uint, len(topRoutes))
+	for _, item := range topRoutes {
+		routeCnts[item.name] = item.counter.total
+	}
+	p.rollups.add(prior_ts, snapshotCnt, routeCnts)
+	for _, dim := range dimensions {
+		if p.keyRates[dim.name] == nil {
+			p.keyRates[dim.name] = make(keyRates)
+		}
+		data := stats.byDimension[dim.name]
+		data.rates = p.keyRates[dim.name].update(data, period, tableCap(dim.bounded))
+	}
+	stats.movers = p.movers.update(stats.byDimension)
+	stats.sections = measured.sections
+	for _, mins := range uniqueWindowMins {
+		stats.uniques = append(stats.uniques, p.uniques.estimates(mins))
+	}
+	for _, cmp := range rollupComparisons {
+		stats.comparisons = append(stats.comparisons, p.rollups.compare(p.snapshot_ts, cmp.window, cmp.ago))
+	}
+	var scored []string /* top routes, descending */
+	for n := 0; n < len(topRoutes) && len(scored) < baselineRoutes; n++ {
+		scored = append(scored, topRoutes[n].name)
+	}
+	stats.anomalies = p.rollups.anomalies(p.snapshot_ts, scored)
+	if p.sessions != nil {
+		var delta *sessionDelta
+		if sharded != nil {
+			delta = sharded.sessions
+		}
+		stats.sessions = p.sessions.summarize(p.snapshot_ts, period, delta)
+	}
+	stats.slos = p.slos.summarize(p.snapshot_ts)
 
 	// traffic data in general
 
@@ -261,6 +707,35 @@ func (p *metrics) takeSnapshot() *statistic {
 	return stats
 }
 
+// returns the stats of the named dimension (c.f. measures.statsBy), or
+// nil if unknown.
+func (p *statistic) by(attribute string) *accessStats {
+	return p.byDimension[attribute]
+}
+
+// bytes served per second in the snapshot period
+func (p *statistic) throughput() float64 {
+	if p.period <= 0 {
+		return 0
+	}
+	return float64(p.accessCnt.bytes) / p.period.Seconds()
+}
+
+// pivots the recent (scoped) accesses (c.f. pivot). The stats are empty if
+// recent accesses are not kept.
+func (p *metrics) pivot(filters []pivotFilter, attribute string) (*accessStats, *accessCounter, error) {
+	var accesses []*logEntry
+	if p.recent != nil {
+		for _, obj := range p.recent.items() {
+			access := obj.(*logEntry)
+			if p.scope == "" || access.vhost == p.scope {
+				accesses = append(accesses, access)
+			}
+		}
+	}
+	return pivot(accesses, filters, attribute)
+}
+
 func (p *metrics) String() string {
 	return fmt.Sprintf("metrics\n\t%s\n\t%v\n\t%v", p.traffic, p.snapshot, p.wip)
 }
@@ -0,0 +1,241 @@
+// friend
+
+//    Copyright © 2016 Joubin Houshyar. All rights reserved.
+//
+//    This file is part of puppy.
+//
+//    puppy is free software: you can redistribute it and/or modify
+//    it under the terms of the GNU Affero General Public License as
+//    published by the Free Software Foundation, either version 3 of
+//    the License, or (at your option) any later version.
+//
+//    puppy is distributed in the hope that it will be useful,
+//    but WITHOUT ANY WARRANTY; without even the implied warranty of
+//    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//    GNU Affero General Public License for more details.
+//
+//    You should have received a copy of the GNU Affero General Public
+//    License along with puppy.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"net/url"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func testAccess(method string, status, bytes uint) *logEntry {
+	return &logEntry{method: method, uri: &url.URL{Path: "/"}, status: status, bytes: bytes}
+}
+
+func TestStatusClass(t *testing.T) {
+	tests := []struct{ status, class uint }{
+		{0, 0}, {99, 0}, {100, 1}, {101, 1}, {200, 2}, {204, 2}, {301, 3},
+		{404, 4}, {499, 4}, {500, 5}, {599, 5}, {600, 0}, {999, 0},
+	}
+	for _, test := range tests {
+		if class := statusClass(test.status); class != test.class {
+			t.Errorf("%d - class %d, expected %d", test.status, class, test.class)
+		}
+	}
+}
+
+func TestStatusCounts(t *testing.T) {
+	testUaRules(t)
+	statuses := []uint{200, 200, 204, 301, 404, 404, 500, 503, 0, 700}
+	a, b := &accessCounter{codes: make(map[uint]uint)}, &accessCounter{codes: make(map[uint]uint)}
+	for i, status := range statuses {
+		counter := a
+		if i%2 == 1 {
+			counter = b
+		}
+		counter.Update(testAccess("GET", status, 0))
+	}
+	a.merge(b)
+	if classes := [6]uint{2, 0, 3, 1, 2, 2}; a.classes != classes {
+		t.Errorf("classes %v, expected %v", a.classes, classes)
+	}
+	codes := map[uint]uint{0: 1, 200: 2, 204: 1, 301: 1, 404: 2, 500: 1, 503: 1, 700: 1}
+	if !reflect.DeepEqual(a.codes, codes) {
+		t.Errorf("codes %v, expected %v", a.codes, codes)
+	}
+	if rate := a.errorRate(); rate != 0.2 {
+		t.Errorf("5xx rate %g, expected 0.2", rate)
+	}
+	if ratios := a.ratios(); ratios.classes[4] != 0.2 || ratios.classes[2] != 0.3 {
+		t.Errorf("class ratios %v", ratios.classes)
+	}
+	if rate := (&accessCounter{}).errorRate(); rate != 0 {
+		t.Errorf("expected no errors if empty, got %g", rate)
+	}
+}
+
+func TestBytesServed(t *testing.T) {
+	testUaRules(t)
+	counter := &accessCounter{}
+	if counter.avgBytes() != 0 {
+		t.Errorf("expected no average if empty")
+	}
+	for _, bytes := range []uint{0, 100, 1 << 20, 7} {
+		counter.Update(testAccess("GET", 200, bytes))
+	}
+	bot := testAccess("GET", 200, 1000)
+	bot.userAgent = "curl/8.0"
+	counter.Update(bot)
+	if counter.bytes != 1<<20+1107 || counter.avgBytes() != (1<<20+1107)/5 {
+		t.Errorf("bytes %d, average %d", counter.bytes, counter.avgBytes())
+	}
+	if counter.filteredBytes(botsOnly) != 1000 || counter.filteredBytes(humansOnly) != 1<<20+107 {
+		t.Errorf("bytes of bots %d, humans %d", counter.filteredBytes(botsOnly), counter.filteredBytes(humansOnly))
+	}
+	merged := &accessCounter{}
+	merged.merge(counter)
+	merged.merge(counter)
+	if merged.bytes != 2*counter.bytes || merged.filteredBytes(botsOnly) != 2000 {
+		t.Errorf("merged bytes %d", merged.bytes)
+	}
+
+	stats := &statistic{accessCnt: counter, period: 2 * time.Second}
+	if throughput := stats.throughput(); throughput != float64(counter.bytes)/2 {
+		t.Errorf("throughput %g", throughput)
+	}
+	if throughput := (&statistic{accessCnt: counter}).throughput(); throughput != 0 {
+		t.Errorf("expected no throughput without a period, got %g", throughput)
+	}
+}
+
+func TestBytesFormat(t *testing.T) {
+	tests := []struct {
+		v float64
+		s string
+	}{
+		{0, "0B"}, {1023, "1023B"}, {1024, "1.0KB"}, {1536, "1.5KB"},
+		{5 << 20, "5.0MB"}, {3 << 30, "3.0GB"}, {1 << 50, "1024.0TB"},
+	}
+	for _, test := range tests {
+		if s := bfmtr(test.v); s != test.s {
+			t.Errorf("%g - got %s, expected %s", test.v, s, test.s)
+		}
+	}
+}
+
+func TestOrderByBytes(t *testing.T) {
+	testUaRules(t)
+	table := newExactTable()
+	for key, bytes := range map[string][]uint{"/big": {5000}, "/many": {1, 1, 1, 1}, "/mid": {300, 300}} {
+		for _, n := range bytes {
+			table.update(key, testAccess("GET", 200, n))
+		}
+	}
+	bot := testAccess("GET", 200, 9000)
+	bot.userAgent = "curl/8.0"
+	table.update("/mid", bot)
+	names := func(items []namedCounter) (names []string) {
+		for _, item := range items {
+			names = append(names, item.name)
+		}
+		return
+	}
+	inOrder := newAccessStats(table).inOrder
+	tests := []struct {
+		filter agentFilter
+		order  tableOrder
+		names  []string
+	}{
+		{allAgents, byRequests, []string{"/big", "/mid", "/many"}},
+		{allAgents, byBytes, []string{"/many", "/big", "/mid"}},
+		{humansOnly, byBytes, []string{"/many", "/mid", "/big"}},
+		{botsOnly, byBytes, []string{"/mid"}},
+	}
+	for _, test := range tests {
+		if got := names(orderStats(inOrder, test.filter, test.order)); !reflect.DeepEqual(got, test.names) {
+			t.Errorf("%s by %d - got %v, expected %v", test.filter, test.order, got, test.names)
+		}
+	}
+}
+
+func TestParseMethod(t *testing.T) {
+	tests := []struct {
+		method string
+		m      httpMethod
+	}{
+		{"GET", methodGet}, {"HEAD", methodHead}, {"POST", methodPost}, {"PUT", methodPut},
+		{"DELETE", methodDelete}, {"CONNECT", methodConnect}, {"OPTIONS", methodOptions},
+		{"TRACE", methodTrace}, {"PATCH", methodPatch},
+		{"get", methodOther}, {"PROPFIND", methodOther}, {"", methodOther}, {"-", methodOther},
+		{"OTHER", methodOther}, {"\x16\x03\x01", methodOther},
+	}
+	for _, test := range tests {
+		if m := parseMethod(test.method); m != test.m {
+			t.Errorf("%q - got %s, expected %s", test.method, m, test.m)
+		}
+	}
+	for m := httpMethod(0); m < methodCount; m++ {
+		if m != methodOther && parseMethod(m.String()) != m {
+			t.Errorf("%s - doesn't round trip", m)
+		}
+	}
+}
+
+func TestMethodCounts(t *testing.T) {
+	testUaRules(t)
+	counter := &accessCounter{}
+	for _, method := range []string{"GET", "GET", "DELETE", "PATCH", "BREW", "OPTIONS"} {
+		counter.Update(testAccess(method, 200, 0))
+	}
+	var expected [methodCount]uint
+	expected[methodGet], expected[methodDelete], expected[methodPatch] = 2, 1, 1
+	expected[methodOptions], expected[methodOther] = 1, 1
+	if counter.methods != expected {
+		t.Errorf("methods %v, expected %v", counter.methods, expected)
+	}
+	if ratios := counter.ratios(); ratios.methods[methodGet] != 2./6 || ratios.methods[methodOther] != 1./6 {
+		t.Errorf("method ratios %v", ratios.methods)
+	}
+}
+
+// status codes and latency are only kept by summaries and timed dimensions
+func TestCounterDetail(t *testing.T) {
+	testUaRules(t)
+	saved := dimensions
+	t.Cleanup(func() { dimensions = saved })
+	if e := initDimensions("host+route"); e != nil {
+		t.Fatal(e)
+	}
+	measures := newMeasures()
+	for i, ua := range []string{"curl/8.0", "-", "-"} {
+		access := testAccess("GET", 200+uint(i), 10)
+		access.remoteHost, access.userAgent = "10.0.0.1", ua
+		access.timed, access.duration = true, time.Duration(i+1)*time.Millisecond
+		measures.Update(access)
+	}
+	if summary := measures.summary; len(summary.codes) != 3 || summary.latency.n != 3 || summary.bots.latency.n != 1 {
+		t.Errorf("summary - codes %v, latency %+v", summary.codes, summary.latency)
+	}
+	for _, dim := range dimensions {
+		for _, item := range measures.tables[dim.name].entries() {
+			if item.counter.codes != nil {
+				t.Errorf("%s %s - counts codes", dim.name, item.name)
+			}
+			if timed := item.counter.latency != nil; timed != dim.timed {
+				t.Errorf("%s %s - latency recorded %t, expected %t", dim.name, item.name, timed, dim.timed)
+			}
+		}
+	}
+	if dim := findDimension("host+route"); !dim.timed || findDimension("host").timed || !findDimension("resource").timed {
+		t.Errorf("expected dimensions of routes timed")
+	}
+	if stats := measures.statsBy("resource"); !stats.timed || stats.inOrder[0].counter.latency.n != 3 {
+		t.Errorf("expected resource latency per key")
+	}
+
+	rollups := newRollups()
+	rollups.add(time.Now(), measures.summary, nil)
+	for _, tier := range rollups.tiers {
+		if counter := tier.current.counter; counter.total != 3 || counter.latency != nil || counter.codes != nil || counter.bots != nil {
+			t.Errorf("%s rollup - got %+v", tier.resolution, counter)
+		}
+	}
+}
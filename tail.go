@@ -71,9 +71,9 @@ func tail(fname string) (*tailProc, error) {
 	}
 	finfo, e := os.Stat(fname)
 	if e != nil {
-		return withError(fmt.Sprintf("ERR - tail - %s", e.Error()))
+		return withError("ERR - tail - %s", e.Error())
 	} else if finfo.IsDir() {
-		return withError(fmt.Sprintf("ERR - tail - %s is a directory", fname))
+		return withError("ERR - tail - %s is a directory", fname)
 	}
 
 	tailcmd := exec.Command("tail", "-F", fname)
@@ -0,0 +1,287 @@
+//    Copyright © 2016 Joubin Houshyar. All rights reserved.
+//
+//    This file is part of puppy.
+//
+//    puppy is free software: you can redistribute it and/or modify
+//    it under the terms of the GNU Affero General Public License as
+//    published by the Free Software Foundation, either version 3 of
+//    the License, or (at your option) any later version.
+//
+//    puppy is distributed in the hope that it will be useful,
+//    but WITHOUT ANY WARRANTY; without even the implied warranty of
+//    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//    GNU Affero General Public License for more details.
+//
+//    You should have received a copy of the GNU Affero General Public
+//    License along with puppy.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import "container/heap"
+
+// General note:
+// measures tables are (by default) exact maps of key -> counter, which
+// grow without bound: a scanner hitting random paths or a botnet will
+// balloon memory within a single snapshot. For the high cardinality
+// attributes (resources, hosts, users) a bounded Space-Saving table can
+// be used instead (c.f. conf.topK), which keeps (at most) k counters.
+//
+// Space-Saving in a nutshell: when a new key arrives and the table is
+// full, the key with the least count is evicted and the new key takes
+// over its counter. Counts are thus over-estimated, by at most the
+// evicted count (the entry's error), and any key with a true count above
+// N/k (N the number of updates) is guaranteed to be in the table.
+//
+// Note that the inherited counter carries over all of its breakdowns
+// (methods, status, latency, ...) so these are approximate as well.
+//
+// The other tables are (optionally) capped instead (c.f. conf.maxKeys),
+// which bounds the dimensions, the totals and the children of each
+// section node (c.f. sectionTree). keyRates are bounded by the same caps
+// (c.f. tableCap) and skip otherKey, as do the route baselines and movers.
+
+// a table of access counters by key
+type counterTable interface {
+	update(key string, access *logEntry) *accessCounter // of the key
+	merge(other counterTable)                           // adds the counts of other
+	clone() counterTable                                // a copy, of the same bounds
+	entries() []namedCounter                            // unordered
+	// k is 0 for exact tables. maxErr is the upper bound of the count
+	// error of any entry (and the count of any unmonitored key).
+	errorBound() (k int, maxErr uint)
+	// the accesses (and estimated distinct keys) folded into otherKey
+	// by capped tables.
+	overflow() (folded uint, keys uint64)
+}
+
+// ----------------------------------------------------------------------
+// exact
+
+type exactTable map[string]*accessCounter
+
+func newExactTable() exactTable { return make(exactTable) }
+
+func (p exactTable) counter(key string) *accessCounter {
+	info, ok := p[key]
+	if !ok {
+		info = &accessCounter{}
+		p[key] = info
+	}
+	return info
+}
+
+func (p exactTable) update(key string, access *logEntry) *accessCounter {
+	counter := p.counter(key)
+	counter.Update(access) // ok to ignore error here
+	return counter
+}
+
+func (p exactTable) merge(other counterTable) {
+	for _, entry := range other.entries() {
+		p.counter(entry.name).merge(entry.counter)
+	}
+}
+
+func (p exactTable) clone() counterTable {
+	c := newExactTable()
+	c.merge(p)
+	return c
+}
+
+func (p exactTable) entries() []namedCounter {
+	entries := make([]namedCounter, 0, len(p))
+	for key, counter := range p {
+		entries = append(entries, namedCounter{key, counter})
+	}
+	return entries
+}
+
+func (p exactTable) errorBound() (int, uint) { return 0, 0 }
+
+func (p exactTable) overflow() (uint, uint64) { return 0, 0 }
+
+// ----------------------------------------------------------------------
+// capped
+
+// the key of the overflow bucket of capped tables
+const otherKey = "(other)"
+
+// an exact table with a hard cap on keys (c.f. conf.maxKeys). Once full,
+// new keys are folded into the otherKey bucket.
+type cappedTable struct {
+	table      exactTable
+	cap        int
+	folded     uint
+	foldedKeys *hll // nil until overflow
+}
+
+func newCappedTable(cap int) *cappedTable {
+	return &cappedTable{table: newExactTable(), cap: cap}
+}
+
+// returns the key to count under, folding the key if over the cap
+func (p *cappedTable) slot(key string, cnt uint) string {
+	if _, ok := p.table[key]; ok || len(p.table) < p.cap {
+		return key
+	}
+	if p.foldedKeys == nil {
+		p.foldedKeys = newHll()
+	}
+	p.foldedKeys.add(key)
+	p.folded += cnt
+	return otherKey
+}
+
+func (p *cappedTable) update(key string, access *logEntry) *accessCounter {
+	return p.table.update(p.slot(key, 1), access)
+}
+
+func (p *cappedTable) merge(other counterTable) {
+	for _, entry := range other.entries() {
+		key := entry.name
+		if key != otherKey {
+			key = p.slot(key, entry.counter.total)
+		}
+		p.table.counter(key).merge(entry.counter)
+	}
+	if capped, ok := other.(*cappedTable); ok && capped.foldedKeys != nil {
+		if p.foldedKeys == nil {
+			p.foldedKeys = newHll()
+		}
+		p.foldedKeys.merge(capped.foldedKeys)
+		p.folded += capped.folded
+	}
+}
+
+func (p *cappedTable) clone() counterTable {
+	c := &cappedTable{table: p.table.clone().(exactTable), cap: p.cap, folded: p.folded}
+	if p.foldedKeys != nil {
+		foldedKeys := *p.foldedKeys
+		c.foldedKeys = &foldedKeys
+	}
+	return c
+}
+
+func (p *cappedTable) entries() []namedCounter { return p.table.entries() }
+
+func (p *cappedTable) errorBound() (int, uint) { return 0, 0 }
+
+func (p *cappedTable) overflow() (uint, uint64) {
+	if p.foldedKeys == nil {
+		return 0, 0
+	}
+	return p.folded, p.foldedKeys.estimate()
+}
+
+// ----------------------------------------------------------------------
+// space-saving
+
+type topKEntry struct {
+	key     string
+	counter *accessCounter
+	xof     int // heap index
+}
+
+// min-heap by counter total
+type topKHeap []*topKEntry
+
+func (h topKHeap) Len() int           { return len(h) }
+func (h topKHeap) Less(i, j int) bool { return h[i].counter.total < h[j].counter.total }
+func (h topKHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].xof, h[j].xof = i, j
+}
+func (h *topKHeap) Push(x interface{}) {
+	entry := x.(*topKEntry)
+	entry.xof = len(*h)
+	*h = append(*h, entry)
+}
+func (h *topKHeap) Pop() interface{} {
+	old := *h
+	entry := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return entry
+}
+
+type topKTable struct {
+	k         int
+	index     map[string]*topKEntry
+	minHeap   topKHeap
+	mergedErr uint // sum of the error bounds of the merged tables
+}
+
+func newTopKTable(k int) *topKTable {
+	return &topKTable{k: k, index: make(map[string]*topKEntry, k), minHeap: make(topKHeap, 0, k)}
+}
+
+// returns the entry of the key, evicting the least if necessary. The
+// caller must fix the heap after counting.
+func (p *topKTable) slot(key string) *topKEntry {
+	entry, ok := p.index[key]
+	switch {
+	case ok:
+	case len(p.minHeap) < p.k:
+		entry = &topKEntry{key: key, counter: &accessCounter{}}
+		heap.Push(&p.minHeap, entry)
+		p.index[key] = entry
+	default:
+		/* evict the least and take over its counter */
+		entry = p.minHeap[0]
+		delete(p.index, entry.key)
+		entry.key = key
+		p.index[key] = entry
+	}
+	return entry
+}
+
+func (p *topKTable) update(key string, access *logEntry) *accessCounter {
+	entry := p.slot(key)
+	entry.counter.Update(access)
+	heap.Fix(&p.minHeap, entry.xof)
+	return entry.counter
+}
+
+// merged keys that are not monitored take over the least counter, as with
+// update, and keys not monitored by other are missing up to its bound, so
+// the error bound is (at most) the sum of both tables' bounds.
+func (p *topKTable) merge(other counterTable) {
+	_, otherErr := other.errorBound()
+	p.mergedErr += otherErr
+	for _, item := range other.entries() {
+		entry := p.slot(item.name)
+		entry.counter.merge(item.counter)
+		heap.Fix(&p.minHeap, entry.xof)
+	}
+}
+
+// copies the entries as is, rather than merging them (and their bounds)
+func (p *topKTable) clone() counterTable {
+	c := &topKTable{k: p.k, index: make(map[string]*topKEntry, p.k), mergedErr: p.mergedErr}
+	c.minHeap = make(topKHeap, len(p.minHeap), p.k)
+	for i, entry := range p.minHeap {
+		counter := &accessCounter{}
+		counter.merge(entry.counter)
+		c.minHeap[i] = &topKEntry{key: entry.key, counter: counter, xof: i}
+		c.index[entry.key] = c.minHeap[i]
+	}
+	return c
+}
+
+func (p *topKTable) entries() []namedCounter {
+	entries := make([]namedCounter, 0, len(p.minHeap))
+	for _, entry := range p.minHeap {
+		entries = append(entries, namedCounter{entry.key, entry.counter})
+	}
+	return entries
+}
+
+// the least count is the bound, but only once the table is full and
+// evictions are possible, plus the bounds of the merged tables.
+func (p *topKTable) errorBound() (int, uint) {
+	if len(p.minHeap) < p.k {
+		return p.k, p.mergedErr
+	}
+	return p.k, p.minHeap[0].counter.total + p.mergedErr
+}
+
+func (p *topKTable) overflow() (uint, uint64) { return 0, 0 }
@@ -0,0 +1,88 @@
+//    Copyright © 2016 Joubin Houshyar. All rights reserved.
+//
+//    This file is part of puppy.
+//
+//    puppy is free software: you can redistribute it and/or modify
+//    it under the terms of the GNU Affero General Public License as
+//    published by the Free Software Foundation, either version 3 of
+//    the License, or (at your option) any later version.
+//
+//    puppy is distributed in the hope that it will be useful,
+//    but WITHOUT ANY WARRANTY; without even the implied warranty of
+//    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//    GNU Affero General Public License for more details.
+//
+//    You should have received a copy of the GNU Affero General Public
+//    License along with puppy.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+// the counts of merged tables are within the reported error bound
+func TestTopKMergeErrorBound(t *testing.T) {
+	const k, shards = 10, 4
+	exact := make(map[string]uint)
+	var merged *topKTable
+	for n := 0; n < shards; n++ {
+		table := newTopKTable(k)
+		for i := 0; i < 1000; i++ {
+			key := fmt.Sprintf("/%d", (i*(n+7))%37) /* skewed differently per shard */
+			if i%3 == 0 {
+				key = "/hot"
+			}
+			table.update(key, &logEntry{})
+			exact[key]++
+		}
+		if merged == nil {
+			merged = table
+			continue
+		}
+		_, before := merged.errorBound()
+		_, other := table.errorBound()
+		merged.merge(table)
+		if _, after := merged.errorBound(); after < before+other {
+			t.Fatalf("bound %d after merge, expected at least %d + %d", after, before, other)
+		}
+	}
+	_, maxErr := merged.errorBound()
+	for _, entry := range merged.entries() {
+		cnt, want := int(entry.counter.total), int(exact[entry.name])
+		if cnt-want > int(maxErr) || want-cnt > int(maxErr) {
+			t.Errorf("%s - count %d, exact %d, error bound %d", entry.name, cnt, want, maxErr)
+		}
+	}
+}
+
+// clones have the same counts and bounds, and are independent of the table
+func TestTableClone(t *testing.T) {
+	tables := map[string]counterTable{"exact": newExactTable(), "capped": newCappedTable(5), "topk": newTopKTable(5)}
+	for name, table := range tables {
+		for i := 0; i < 100; i++ {
+			table.update(fmt.Sprintf("/%d", i%(1+i%13)), &logEntry{})
+		}
+		clone := table.clone()
+		if a, b := tableCounts(table), tableCounts(clone); !reflect.DeepEqual(a, b) {
+			t.Errorf("%s - counts %v, clone %v", name, a, b)
+		}
+		k, maxErr := table.errorBound()
+		if cloneK, cloneErr := clone.errorBound(); cloneK != k || cloneErr != maxErr {
+			t.Errorf("%s - bound %d/%d, clone %d/%d", name, k, maxErr, cloneK, cloneErr)
+		}
+		folded, keys := table.overflow()
+		if cloneFolded, cloneKeys := clone.overflow(); cloneFolded != folded || cloneKeys != keys {
+			t.Errorf("%s - overflow %d/%d, clone %d/%d", name, folded, keys, cloneFolded, cloneKeys)
+		}
+		counts := tableCounts(table)
+		for i := 0; i < 100; i++ {
+			clone.update("/new", &logEntry{})
+		}
+		if !reflect.DeepEqual(tableCounts(table), counts) {
+			t.Errorf("%s - updating the clone updated the table", name)
+		}
+	}
+}
@@ -0,0 +1,93 @@
+//    Copyright © 2016 Joubin Houshyar. All rights reserved.
+//
+//    This file is part of puppy.
+//
+//    puppy is free software: you can redistribute it and/or modify
+//    it under the terms of the GNU Affero General Public License as
+//    published by the Free Software Foundation, either version 3 of
+//    the License, or (at your option) any later version.
+//
+//    puppy is distributed in the hope that it will be useful,
+//    but WITHOUT ANY WARRANTY; without even the implied warranty of
+//    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//    GNU Affero General Public License for more details.
+//
+//    You should have received a copy of the GNU Affero General Public
+//    License along with puppy.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// General note:
+// snapshots only cover a period. totals are running counts since puppy
+// started, or since last reset (a la stopwatch), e.g. to measure the
+// traffic around a deploy. Method and status counts are those of the
+// summary counter. totals are unscoped.
+
+// the attributes of which totals are kept
+var totalsAttributes = []string{"resource", "host", "user"}
+
+type totals struct {
+	since   time.Time
+	summary *accessCounter
+	tables  map[string]counterTable
+}
+
+func newTotals(since time.Time) *totals {
+	p := &totals{
+		since:   since,
+		summary: newSummaryCounter(),
+		tables:  make(map[string]counterTable, len(totalsAttributes)),
+	}
+	// bounded or capped as with measures, lest they grow for the lifetime
+	// of the process
+	for _, attribute := range totalsAttributes {
+		p.tables[attribute] = newCounterTable(true)
+	}
+	return p
+}
+
+func (p *totals) Update(access *logEntry) error {
+	if access == nil {
+		return fmt.Errorf("err - totals.update - assert - access is nil")
+	}
+	p.summary.Update(access)
+	for _, attribute := range totalsAttributes {
+		table := p.tables[attribute]
+		for _, key := range fieldKeyFns[attribute](access) {
+			table.update(key, access)
+		}
+	}
+	return nil
+}
+
+// adds the counts of other (of a shard, c.f. pipeline)
+func (p *totals) merge(other *totals) {
+	p.summary.merge(other.summary)
+	for attribute, table := range other.tables {
+		p.tables[attribute].merge(table)
+	}
+}
+
+// returns a copy (of a shard's totals, c.f. pipeline)
+func (p *totals) clone() *totals {
+	c := &totals{since: p.since, summary: newSummaryCounter(), tables: make(map[string]counterTable, len(p.tables))}
+	c.summary.merge(p.summary)
+	for attribute, table := range p.tables {
+		c.tables[attribute] = table.clone()
+	}
+	return c
+}
+
+// panics
+func (p *totals) statsBy(attribute string) *accessStats {
+	data, ok := p.tables[attribute]
+	if !ok {
+		panic(fmt.Sprintf("bug - totals.statsBy - unknown attribute %s", attribute))
+	}
+	return newAccessStats(data)
+}
@@ -37,9 +37,10 @@ import (
 var stty_restore string
 
 // sets up the attached terminal for puppy's use. Any error here is
-// treated as fatal and will os.Exit without ceremony.
+// treated as fatal and will os.Exit without ceremony. Called on startup
+// after initDisplay (c.f. main).
 //
-func init() { // get tty current settings
+func initTerminal() { // get tty current settings
 	ttystate, e := sttycmd("-g")
 	if e != nil {
 		log.Fatalf("err - stty -g;  %s\n", e.Error())
@@ -70,7 +71,7 @@ func checkForTerminal() (e error) {
 	return
 }
 
-// complement to init(), a somewhat vigorous attempt to restore terminal
+// complement to initTerminal(), a somewhat vigorous attempt to restore terminal
 // state. Per various (adhoc/functional) tests of various failure/stop
 // modes of puppy (e.g. on quit or on interrupts) this is fine and will
 // not leave the terminal in a messed up state. That said, this needs
@@ -184,7 +185,7 @@ func fillRow(row uint, c byte) {
 // text is always restored to NORMTEXT on return
 func ttyfmt(s string, codes ...code) {
 	ttycmds(codes...)
-	fmt.Printf(s)
+	fmt.Print(s)
 	ttycmd(NORMTEXT)
 }
 
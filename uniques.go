@@ -0,0 +1,182 @@
+//    Copyright © 2016 Joubin Houshyar. All rights reserved.
+//
+//    This file is part of puppy.
+//
+//    puppy is free software: you can redistribute it and/or modify
+//    it under the terms of the GNU Affero General Public License as
+//    published by the Free Software Foundation, either version 3 of
+//    the License, or (at your option) any later version.
+//
+//    puppy is distributed in the hope that it will be useful,
+//    but WITHOUT ANY WARRANTY; without even the implied warranty of
+//    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//    GNU Affero General Public License for more details.
+//
+//    You should have received a copy of the GNU Affero General Public
+//    License along with puppy.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"hash/maphash"
+	"math"
+	"math/bits"
+)
+
+// General note:
+// accessStats.total is the count of distinct keys of a single snapshot,
+// and distinct counts can't be summed across snapshots. HyperLogLog
+// sketches can be merged (union), so each snapshot keeps a sketch per
+// attribute, and sketches are merged to estimate the unique count of
+// longer windows at constant memory (c.f. uniqueWindows).
+
+// ----------------------------------------------------------------------
+// hyperloglog
+
+// 2^12 registers, for a standard error of 1.04/sqrt(2^12) ~ 1.6%
+const hllPrecision = 12
+
+// per process seed. Sketches are never persisted so this is fine.
+var hllSeed = maphash.MakeSeed()
+
+type hll struct {
+	registers [1 << hllPrecision]uint8
+}
+
+func newHll() *hll { return &hll{} }
+
+func (p *hll) add(key string) {
+	h := maphash.String(hllSeed, key)
+	xof := h >> (64 - hllPrecision)
+	w := h<<hllPrecision | 1<<(hllPrecision-1) // guard bit bounds rho
+	rho := uint8(bits.LeadingZeros64(w) + 1)
+	if rho > p.registers[xof] {
+		p.registers[xof] = rho
+	}
+}
+
+// merges other into the receiver (union)
+func (p *hll) merge(other *hll) {
+	for i, v := range other.registers {
+		if v > p.registers[i] {
+			p.registers[i] = v
+		}
+	}
+}
+
+func (p *hll) estimate() uint64 {
+	const m = float64(1 << hllPrecision)
+	sum, zeros := 0., 0
+	for _, v := range p.registers {
+		sum += math.Ldexp(1, -int(v))
+		if v == 0 {
+			zeros++
+		}
+	}
+	alpha := 0.7213 / (1 + 1.079/m)
+	e := alpha * m * m / sum
+	if e <= 2.5*m && zeros > 0 { /* small range correction */
+		e = m * math.Log(m/float64(zeros))
+	}
+	return uint64(e + .5)
+}
+
+// ----------------------------------------------------------------------
+// unique counts by attribute
+
+// the attributes of which unique counts are estimated
+const (
+	uniqueHosts = iota
+	uniqueUsers
+	uniqueResources
+	uniqueCount // not an attribute
+)
+
+var uniqueNames = [uniqueCount]string{"hosts", "users", "resources"}
+
+type uniqueSketches [uniqueCount]*hll
+
+func newUniqueSketches() *uniqueSketches {
+	var p uniqueSketches
+	for i := range p {
+		p[i] = newHll()
+	}
+	return &p
+}
+
+func (p *uniqueSketches) Update(access *logEntry) {
+	p[uniqueHosts].add(access.host())
+	p[uniqueUsers].add(access.user)
+	p[uniqueResources].add(access.resource())
+}
+
+func (p *uniqueSketches) merge(other *uniqueSketches) {
+	for i := range p {
+		p[i].merge(other[i])
+	}
+}
+
+func (p *uniqueSketches) estimates() (counts [uniqueCount]uint64) {
+	for i := range p {
+		counts[i] = p[i].estimate()
+	}
+	return
+}
+
+// ----------------------------------------------------------------------
+// windows
+
+// the windows (in minutes) reported
+var uniqueWindowMins = []uint{1, 5, 60}
+
+// uniqueWindows maintains the sketches of the last minute of snapshots,
+// and of the last hour of minutes. The 1m window is exact (to the
+// snapshot), and the n minute windows are the union of the last minute,
+// the current (partial) minute, and the prior n-1 whole minutes, so cover
+// between n-1 and n minutes.
+type uniqueWindows struct {
+	snapshots  *ringBuffer // <*uniqueSketches> : last minute
+	minutes    *ringBuffer // <*uniqueSketches> : last hour
+	minute     *uniqueSketches
+	perMinute  uint // snapshots per minute
+	minuteSnap uint // snapshots in current minute
+}
+
+func newUniqueWindows(perMinute uint) *uniqueWindows {
+	if perMinute == 0 {
+		perMinute = 1
+	}
+	return &uniqueWindows{
+		snapshots: newRingBuffer(perMinute),
+		minutes:   newRingBuffer(60),
+		minute:    newUniqueSketches(),
+		perMinute: perMinute,
+	}
+}
+
+// adds a snapshot's sketches
+func (p *uniqueWindows) add(sketches *uniqueSketches) {
+	p.snapshots.add(sketches)
+	p.minute.merge(sketches)
+	p.minuteSnap++
+	if p.minuteSnap == p.perMinute {
+		p.minutes.add(p.minute)
+		p.minute = newUniqueSketches()
+		p.minuteSnap = 0
+	}
+}
+
+// returns the unique count estimates of the last n minutes
+func (p *uniqueWindows) estimates(mins uint) [uniqueCount]uint64 {
+	union := newUniqueSketches()
+	for _, obj := range p.snapshots.items() {
+		union.merge(obj.(*uniqueSketches))
+	}
+	if mins > 1 {
+		union.merge(p.minute)
+		for _, obj := range p.minutes.last(mins - 1) {
+			union.merge(obj.(*uniqueSketches))
+		}
+	}
+	return union.estimates()
+}
@@ -0,0 +1,126 @@
+// friend
+
+//    Copyright © 2016 Joubin Houshyar. All rights reserved.
+//
+//    This file is part of puppy.
+//
+//    puppy is free software: you can redistribute it and/or modify
+//    it under the terms of the GNU Affero General Public License as
+//    published by the Free Software Foundation, either version 3 of
+//    the License, or (at your option) any later version.
+//
+//    puppy is distributed in the hope that it will be useful,
+//    but WITHOUT ANY WARRANTY; without even the implied warranty of
+//    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//    GNU Affero General Public License for more details.
+//
+//    You should have received a copy of the GNU Affero General Public
+//    License along with puppy.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"fmt"
+	"math"
+	"testing"
+)
+
+// 3 standard errors of the estimates
+var hllTolerance = 3 * 1.04 / math.Sqrt(1<<hllPrecision)
+
+func hllOf(prefix string, from, to int) *hll {
+	p := newHll()
+	for i := from; i < to; i++ {
+		p.add(fmt.Sprintf("%s%d", prefix, i))
+	}
+	return p
+}
+
+func checkEstimate(t *testing.T, name string, estimate uint64, n int) {
+	t.Helper()
+	if e := math.Abs(float64(estimate)-float64(n)) / float64(n); e > hllTolerance {
+		t.Errorf("%s - estimate %d of %d, error %.2f%% over %.2f%%", name, estimate, n, 100*e, 100*hllTolerance)
+	}
+}
+
+func TestHllAccuracy(t *testing.T) {
+	for _, n := range []int{1000, 100000} {
+		checkEstimate(t, fmt.Sprintf("%d keys", n), hllOf("key-", 0, n).estimate(), n)
+	}
+	/* duplicates don't count */
+	p := hllOf("key-", 0, 1000)
+	for i := 0; i < 10; i++ {
+		p.merge(hllOf("key-", 0, 1000))
+		p.add("key-1")
+	}
+	checkEstimate(t, "duplicates", p.estimate(), 1000)
+}
+
+// small counts are in the linear counting range, so close to exact
+func TestHllSmallRange(t *testing.T) {
+	if estimate := newHll().estimate(); estimate != 0 {
+		t.Errorf("empty - estimate %d", estimate)
+	}
+	for _, n := range []int{1, 2, 10, 100} {
+		if estimate := hllOf("x", 0, n).estimate(); math.Abs(float64(estimate)-float64(n)) > math.Max(1, 0.02*float64(n)) {
+			t.Errorf("%d keys - estimate %d", n, estimate)
+		}
+	}
+}
+
+func TestHllMerge(t *testing.T) {
+	a, b := hllOf("key-", 0, 60000), hllOf("key-", 40000, 100000)
+	a.merge(b)
+	checkEstimate(t, "union", a.estimate(), 100000)
+	union := a.estimate()
+	a.merge(b)
+	if a.estimate() != union {
+		t.Errorf("merge isn't idempotent, %d then %d", union, a.estimate())
+	}
+	if merged := newHll(); true {
+		merged.merge(b)
+		if merged.estimate() != b.estimate() {
+			t.Errorf("merge into empty - %d, expected %d", merged.estimate(), b.estimate())
+		}
+	}
+}
+
+// snapshots of 100 distinct hosts each
+func uniqueSnapshot(n int) *uniqueSketches {
+	p := newUniqueSketches()
+	p[uniqueHosts] = hllOf(fmt.Sprintf("snapshot-%d-", n), 0, 100)
+	return p
+}
+
+func TestUniqueWindows(t *testing.T) {
+	windows := newUniqueWindows(3)
+	tests := []struct {
+		snapshots   int // added so far
+		m1, m5, m60 int // expected hosts of the windows
+	}{
+		{1, 100, 100, 100},
+		{3, 300, 300, 300},    /* the 1st minute rolls over */
+		{4, 300, 400, 400},    /* 1m is the last 3 snapshots */
+		{15, 300, 1200, 1500}, /* the 4 prior whole minutes only */
+		{16, 300, 1300, 1600}, /* the partial minute and the 4 prior */
+	}
+	added := 0
+	for _, test := range tests {
+		for ; added < test.snapshots; added++ {
+			windows.add(uniqueSnapshot(added))
+		}
+		for _, window := range []struct {
+			mins uint
+			n    int
+		}{{1, test.m1}, {5, test.m5}, {60, test.m60}} {
+			name := fmt.Sprintf("%d snapshots, %dm", test.snapshots, window.mins)
+			checkEstimate(t, name, windows.estimates(window.mins)[uniqueHosts], window.n)
+		}
+	}
+	if windows.minuteSnap != 1 || windows.perMinute != 3 {
+		t.Errorf("expected 1 snapshot in the current minute, got %d", windows.minuteSnap)
+	}
+	if newUniqueWindows(0).perMinute != 1 {
+		t.Errorf("expected at least 1 snapshot per minute")
+	}
+}
@@ -0,0 +1,186 @@
+//    Copyright © 2016 Joubin Houshyar. All rights reserved.
+//
+//    This file is part of puppy.
+//
+//    puppy is free software: you can redistribute it and/or modify
+//    it under the terms of the GNU Affero General Public License as
+//    published by the Free Software Foundation, either version 3 of
+//    the License, or (at your option) any later version.
+//
+//    puppy is distributed in the hope that it will be useful,
+//    but WITHOUT ANY WARRANTY; without even the implied warranty of
+//    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//    GNU Affero General Public License for more details.
+//
+//    You should have received a copy of the GNU Affero General Public
+//    License along with puppy.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"bufio"
+	_ "embed"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// General note:
+// user-agent classification is entirely offline, per an ordered list of
+// regexp rules (c.f. uarules.txt) which is embedded in the binary and may
+// be replaced at runtime (c.f. conf.uaRules). Given that regexp matching
+// is not cheap and that the number of distinct user-agents in a log is
+// typically small, classifications are cached. The cache is shared by
+// the pipeline shards, so is locked.
+
+//go:embed uarules.txt
+var uaRulesEmbedded string
+
+// classifications of unmatched kinds
+const (
+	uaOther         = "other"
+	uaDeviceDefault = "desktop"
+)
+
+// classification of a user-agent
+type userAgent struct {
+	browser string
+	os      string
+	device  string
+	bot     string // crawler name, "" if not a bot
+}
+
+func (p *userAgent) isBot() bool { return p.bot != "" }
+
+// filters counts by agent type (c.f. accessCounter.filtered)
+type agentFilter byte
+
+const (
+	allAgents agentFilter = iota
+	humansOnly
+	botsOnly
+)
+
+func (f agentFilter) String() string {
+	switch f {
+	case humansOnly:
+		return "humans"
+	case botsOnly:
+		return "bots"
+	}
+	return "all"
+}
+
+type uaRule struct {
+	name    string
+	pattern *regexp.Regexp
+}
+
+type uaClassifier struct {
+	bots, browsers, oses, devices []uaRule
+	cache                         map[string]*userAgent
+	cacheLock                     sync.RWMutex // c.f. pipeline
+}
+
+// bounds the classifier cache. The cache is simply dropped when full.
+const uaCacheSize = 1 << 14
+
+// the classifier (set on startup)
+var uaRules *uaClassifier
+
+// parses the rules per format documented in uarules.txt.
+func newUaClassifier(rules string) (*uaClassifier, error) {
+	p := &uaClassifier{cache: make(map[string]*userAgent)}
+	scanner := bufio.NewScanner(strings.NewReader(rules))
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) < 3 {
+			return nil, fmt.Errorf("err - newUaClassifier - line:%d - expecting <kind> <name> <pattern>", n)
+		}
+		kind, name := fields[0], fields[1]
+		expr := strings.TrimSpace(line[len(kind):])
+		expr = strings.TrimSpace(expr[len(name):])
+		pattern, e := regexp.Compile(expr)
+		if e != nil {
+			return nil, fmt.Errorf("err - newUaClassifier - line:%d - %s", n, e.Error())
+		}
+		rule := uaRule{name, pattern}
+		switch kind {
+		case "bot":
+			p.bots = append(p.bots, rule)
+		case "browser":
+			p.browsers = append(p.browsers, rule)
+		case "os":
+			p.oses = append(p.oses, rule)
+		case "device":
+			p.devices = append(p.devices, rule)
+		default:
+			return nil, fmt.Errorf("err - newUaClassifier - line:%d - unknown kind %q", n, kind)
+		}
+	}
+	return p, scanner.Err()
+}
+
+// loads the rules file, or the embedded rules if fname is "".
+func loadUaClassifier(fname string) (*uaClassifier, error) {
+	if fname == "" {
+		return newUaClassifier(uaRulesEmbedded)
+	}
+	rules, e := os.ReadFile(fname)
+	if e != nil {
+		return nil, fmt.Errorf("err - loadUaClassifier - %s", e.Error())
+	}
+	return newUaClassifier(string(rules))
+}
+
+func (p *uaClassifier) classify(ua string) *userAgent {
+	p.cacheLock.RLock()
+	agent, ok := p.cache[ua]
+	p.cacheLock.RUnlock()
+	if ok {
+		return agent
+	}
+	match := func(rules []uaRule, otherwise string) string {
+		for _, rule := range rules {
+			if rule.pattern.MatchString(ua) {
+				return rule.name
+			}
+		}
+		return otherwise
+	}
+	agent = &userAgent{
+		browser: match(p.browsers, uaOther),
+		os:      match(p.oses, uaOther),
+		device:  match(p.devices, uaDeviceDefault),
+		bot:     match(p.bots, ""),
+	}
+	p.cacheLock.Lock()
+	if len(p.cache) == uaCacheSize {
+		p.cache = make(map[string]*userAgent)
+	}
+	p.cache[ua] = agent
+	p.cacheLock.Unlock()
+	return agent
+}
+
+// classification of entries without a user-agent, be it absent (e.g.
+// CLF) or "-" (e.g. Combined), so both formats count them alike.
+var uaUnknown = &userAgent{uaOther, uaOther, uaOther, ""}
+
+// returns the (cached) classification of the entry's user-agent.
+func (p *logEntry) classify() *userAgent {
+	if p.agent == nil {
+		if p.userAgent == "" || p.userAgent == "-" {
+			p.agent = uaUnknown
+		} else {
+			p.agent = uaRules.classify(p.userAgent)
+		}
+	}
+	return p.agent
+}
@@ -0,0 +1,96 @@
+// friend
+
+//    Copyright © 2016 Joubin Houshyar. All rights reserved.
+//
+//    This file is part of puppy.
+//
+//    puppy is free software: you can redistribute it and/or modify
+//    it under the terms of the GNU Affero General Public License as
+//    published by the Free Software Foundation, either version 3 of
+//    the License, or (at your option) any later version.
+//
+//    puppy is distributed in the hope that it will be useful,
+//    but WITHOUT ANY WARRANTY; without even the implied warranty of
+//    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//    GNU Affero General Public License for more details.
+//
+//    You should have received a copy of the GNU Affero General Public
+//    License along with puppy.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"net/url"
+	"testing"
+	"time"
+)
+
+func testUaRules(t testing.TB) {
+	if uaRules == nil {
+		var e error
+		if uaRules, e = loadUaClassifier(""); e != nil {
+			t.Fatal(e)
+		}
+	}
+}
+
+func TestClassifyMissingAgent(t *testing.T) {
+	testUaRules(t)
+	for _, ua := range []string{"", "-"} {
+		if agent := (&logEntry{userAgent: ua}).classify(); agent != uaUnknown {
+			t.Errorf("%q - expected unknown, got %+v", ua, agent)
+		}
+	}
+	if agent := (&logEntry{userAgent: "curl/8.0"}).classify(); !agent.isBot() {
+		t.Errorf("curl - expected a bot, got %+v", agent)
+	}
+}
+
+// the agent views of a counter account for every column, not just counts
+func TestAccessCounterView(t *testing.T) {
+	testUaRules(t)
+	access := func(ua string, status, bytes uint, ms int) *logEntry {
+		return &logEntry{method: "GET", uri: &url.URL{Path: "/"}, userAgent: ua, status: status, bytes: bytes,
+			timed: true, duration: time.Duration(ms) * time.Millisecond}
+	}
+	firefox := "Mozilla/5.0 (X11; Linux x86_64; rv:120.0) Gecko/20100101 Firefox/120.0"
+	counter := &accessCounter{codes: make(map[uint]uint)}
+	for _, a := range []*logEntry{
+		access(firefox, 200, 100, 10),
+		access(firefox, 500, 10, 20),
+		access("Googlebot/2.1", 200, 1000, 900),
+		access("curl/8.0", 404, 1, 800),
+		access("-", 200, 5, 30),
+	} {
+		counter.Update(a)
+		counter.recordLatency(a)
+	}
+	tests := []struct {
+		filter    agentFilter
+		total     uint
+		bytes     uint64
+		errorRate float64
+		p50       time.Duration
+		codes     map[uint]uint
+	}{
+		{allAgents, 5, 1116, 0.2, 30 * time.Millisecond, map[uint]uint{200: 3, 404: 1, 500: 1}},
+		{humansOnly, 3, 115, 1. / 3, 20 * time.Millisecond, map[uint]uint{200: 2, 500: 1}},
+		{botsOnly, 2, 1001, 0, 800 * time.Millisecond, map[uint]uint{200: 1, 404: 1}},
+	}
+	for _, test := range tests {
+		view := counter.view(test.filter)
+		if view.total != test.total || view.total != counter.filtered(test.filter) || view.bytes != test.bytes ||
+			view.errorRate() != test.errorRate || view.classes[2]+view.classes[4]+view.classes[5] != test.total {
+			t.Errorf("%s - got %+v", test.filter, view)
+		}
+		if test.filter != botsOnly && len(view.codes) != len(test.codes) {
+			t.Errorf("%s - codes %v, expected %v", test.filter, view.codes, test.codes)
+		}
+		if p50 := view.latency.quantile(.5); p50 < test.p50*99/100 || p50 > test.p50*101/100 {
+			t.Errorf("%s - p50 %s, expected ~%s", test.filter, p50, test.p50)
+		}
+	}
+	if view := (&accessCounter{total: 1}).view(botsOnly); view.total != 0 {
+		t.Errorf("expected an empty bots view, got %+v", view)
+	}
+}
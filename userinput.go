@@ -37,13 +37,29 @@ type uiEvent byte
 // ----------------------------------------------------------------------
 // keystroke -> event mappings
 
-func doQuit(e uiEvent) bool     { return e == 'q' || e == '\033' }
-func viewStats(e uiEvent) bool  { return e == 's' || e == 'S' }
-func viewAlerts(e uiEvent) bool { return e == 'a' || e == 'A' }
-func viewLog(e uiEvent) bool    { return e == 'l' || e == 'L' }
-func viewDebug(e uiEvent) bool  { return e == 'd' }
-func pageUp(e uiEvent) bool     { return e == 'p' } /* prev */
-func pageDown(e uiEvent) bool   { return e == 'n' } /* next */
+func doQuit(e uiEvent) bool         { return e == 'q' || e == '\033' }
+func viewStats(e uiEvent) bool      { return e == 's' || e == 'S' }
+func viewAlerts(e uiEvent) bool     { return e == 'a' || e == 'A' }
+func viewLog(e uiEvent) bool        { return e == 'l' || e == 'L' }
+func viewDebug(e uiEvent) bool      { return e == 'd' }
+func viewTree(e uiEvent) bool       { return e == 't' || e == 'T' }
+func viewParams(e uiEvent) bool     { return e == 'u' || e == 'U' } /* url query */
+func viewSessions(e uiEvent) bool   { return e == 'e' || e == 'E' }
+func viewSlo(e uiEvent) bool        { return e == 'o' || e == 'O' } /* objectives */
+func viewTotals(e uiEvent) bool     { return e == 'x' || e == 'X' }
+func viewMovers(e uiEvent) bool     { return e == 'm' || e == 'M' }
+func pageUp(e uiEvent) bool         { return e == 'p' } /* prev */
+func pageDown(e uiEvent) bool       { return e == 'n' } /* next */
+func cursorUp(e uiEvent) bool       { return e == 'k' }
+func cursorDown(e uiEvent) bool     { return e == 'j' }
+func expandRow(e uiEvent) bool      { return e == '+' }
+func collapseRow(e uiEvent) bool    { return e == '-' }
+func cycleTable(e uiEvent) bool     { return e == 'c' } /* table column */
+func cycleFilter(e uiEvent) bool    { return e == 'h' } /* humans/bots */
+func cycleScope(e uiEvent) bool     { return e == 'v' } /* vhost */
+func cycleOrder(e uiEvent) bool     { return e == 'b' } /* requests/bytes */
+func resetTotals(e uiEvent) bool    { return e == 'z' } /* zero */
+func cycleReference(e uiEvent) bool { return e == 'w' } /* movers prior/window */
 
 // returns true if any of the provided comparators (e.g. doQuit())
 // match the receiver.